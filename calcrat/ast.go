@@ -0,0 +1,152 @@
+package calcrat
+
+// Node is the interface implemented by all nodes of the AST.
+// Pos and End return the byte offsets of the beginning of the node and just after the node in the formula.
+type Node interface {
+	Pos() int
+	End() int
+}
+
+// Expr is the interface implemented by all expression nodes.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// NumberLit is a numeric literal. Value is the literal as written in the formula.
+type NumberLit struct {
+	ValuePos int
+	Value    string
+}
+
+// UnitLit is a numeric literal followed by a unit such as 3 m. It can be evaluated only by Units.
+type UnitLit struct {
+	Number  *NumberLit
+	UnitPos int
+	Unit    string
+}
+
+// Ident is an identifier of a named value or a function.
+type Ident struct {
+	NamePos int
+	Name    string
+}
+
+// UnaryExpr is a prefix operation such as -x.
+type UnaryExpr struct {
+	OpPos int
+	Op    string
+	X     Expr
+}
+
+// BinaryExpr is a binary operation such as x + y.
+type BinaryExpr struct {
+	X     Expr
+	OpPos int
+	Op    string
+	Y     Expr
+}
+
+// Paren is an expression enclosed in brackets.
+type Paren struct {
+	Lparen int
+	X      Expr
+	Rparen int
+}
+
+// Call is a function call. if(cond, then, else) is also represented as Call.
+type Call struct {
+	Fun    *Ident
+	Lparen int
+	Args   []Expr
+	Rparen int
+}
+
+// CondExpr is a conditional expression cond ? then : else.
+type CondExpr struct {
+	Cond     Expr
+	Question int
+	Then     Expr
+	Colon    int
+	Else     Expr
+}
+
+func (x *NumberLit) Pos() int  { return x.ValuePos }
+func (x *UnitLit) Pos() int    { return x.Number.Pos() }
+func (x *Ident) Pos() int      { return x.NamePos }
+func (x *UnaryExpr) Pos() int  { return x.OpPos }
+func (x *BinaryExpr) Pos() int { return x.X.Pos() }
+func (x *Paren) Pos() int      { return x.Lparen }
+func (x *Call) Pos() int       { return x.Fun.Pos() }
+func (x *CondExpr) Pos() int   { return x.Cond.Pos() }
+
+func (x *NumberLit) End() int  { return x.ValuePos + len(x.Value) }
+func (x *UnitLit) End() int    { return x.UnitPos + len(x.Unit) }
+func (x *Ident) End() int      { return x.NamePos + len(x.Name) }
+func (x *UnaryExpr) End() int  { return x.X.End() }
+func (x *BinaryExpr) End() int { return x.Y.End() }
+func (x *Paren) End() int      { return x.Rparen + 1 }
+func (x *Call) End() int       { return x.Rparen + 1 }
+func (x *CondExpr) End() int   { return x.Else.End() }
+
+func (*NumberLit) exprNode()  {}
+func (*UnitLit) exprNode()    {}
+func (*Ident) exprNode()      {}
+func (*UnaryExpr) exprNode()  {}
+func (*BinaryExpr) exprNode() {}
+func (*Paren) exprNode()      {}
+func (*Call) exprNode()       {}
+func (*CondExpr) exprNode()   {}
+
+// Visitor is called for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order like go/ast.Walk.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *NumberLit, *Ident:
+		// nothing to do
+	case *UnitLit:
+		Walk(v, n.Number)
+	case *UnaryExpr:
+		Walk(v, n.X)
+	case *BinaryExpr:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *Paren:
+		Walk(v, n.X)
+	case *Call:
+		Walk(v, n.Fun)
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *CondExpr:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		Walk(v, n.Else)
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order like go/ast.Inspect.
+// If f returns true, Inspect invokes f recursively for each of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
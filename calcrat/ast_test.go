@@ -0,0 +1,110 @@
+package calcrat_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestParseBuildsAST(t *testing.T) {
+	x, err := calcrat.Parse("-a + max(b, 0x10) * (c)")
+	OK(t, err)
+
+	add, ok := x.(*calcrat.BinaryExpr)
+	ASSERT(t, "root should be BinaryExpr", ok)
+	EQUALS(t, "operator should be +", "+", add.Op)
+	EQUALS(t, "operator position should match", 3, add.OpPos)
+
+	neg, ok := add.X.(*calcrat.UnaryExpr)
+	ASSERT(t, "left should be UnaryExpr", ok)
+	EQUALS(t, "operand should be identifier", &calcrat.Ident{NamePos: 1, Name: "a"}, neg.X)
+
+	mul, ok := add.Y.(*calcrat.BinaryExpr)
+	ASSERT(t, "right should be BinaryExpr", ok)
+	EQUALS(t, "operator should be *", "*", mul.Op)
+
+	call, ok := mul.X.(*calcrat.Call)
+	ASSERT(t, "left of * should be Call", ok)
+	EQUALS(t, "function name should match", "max", call.Fun.Name)
+	EQUALS(t, "number of arguments should match", 2, len(call.Args))
+	EQUALS(t, "literal should keep its notation", &calcrat.NumberLit{ValuePos: 12, Value: "0x10"}, call.Args[1])
+	EQUALS(t, "call should start at function name", 5, call.Pos())
+	EQUALS(t, "call should end after bracket", 17, call.End())
+
+	p, ok := mul.Y.(*calcrat.Paren)
+	ASSERT(t, "right of * should be Paren", ok)
+	EQUALS(t, "paren should start at bracket", 20, p.Pos())
+	EQUALS(t, "paren should end after bracket", 23, p.End())
+
+	EQUALS(t, "root should span whole formula", 0, x.Pos())
+	EQUALS(t, "root should span whole formula", 23, x.End())
+}
+
+func TestParseBuildsConditionalExpression(t *testing.T) {
+	x, err := calcrat.Parse("a ? b : c ? d : e")
+	OK(t, err)
+
+	c, ok := x.(*calcrat.CondExpr)
+	ASSERT(t, "root should be CondExpr", ok)
+	EQUALS(t, "question position should match", 2, c.Question)
+	EQUALS(t, "colon position should match", 6, c.Colon)
+	_, ok = c.Else.(*calcrat.CondExpr)
+	ASSERT(t, "conditional expression should be right associative", ok)
+}
+
+type recorder struct {
+	events *[]string
+}
+
+func (r recorder) Visit(n calcrat.Node) calcrat.Visitor {
+	switch n := n.(type) {
+	case nil:
+		*r.events = append(*r.events, "end")
+	case *calcrat.Ident:
+		*r.events = append(*r.events, n.Name)
+	case *calcrat.NumberLit:
+		*r.events = append(*r.events, n.Value)
+	default:
+		*r.events = append(*r.events, fmt.Sprintf("%T", n))
+	}
+	return r
+}
+
+func TestWalkVisitsNodesInDepthFirstOrder(t *testing.T) {
+	x, err := calcrat.Parse("f(a, 1) - (b)")
+	OK(t, err)
+
+	events := []string{}
+	calcrat.Walk(recorder{&events}, x)
+	EQUALS(t, "nodes should be visited in depth-first order",
+		"*calcrat.BinaryExpr *calcrat.Call f end a end 1 end end *calcrat.Paren b end end end",
+		strings.Join(events, " "))
+}
+
+func TestInspectCanRewriteIdentifiers(t *testing.T) {
+	x, err := calcrat.Parse("price * (1 + rate) - if(rate > 1, price, 0)")
+	OK(t, err)
+
+	names := []string{}
+	calcrat.Inspect(x, func(n calcrat.Node) bool {
+		if id, ok := n.(*calcrat.Ident); ok {
+			names = append(names, id.Name)
+			id.Name = strings.ToUpper(id.Name)
+		}
+		return true
+	})
+	EQUALS(t, "identifiers should be visited in order", []string{"price", "rate", "if", "rate", "price"}, names)
+
+	count := 0
+	calcrat.Inspect(x, func(n calcrat.Node) bool {
+		if id, ok := n.(*calcrat.Ident); ok && id.Name == "PRICE" {
+			count++
+		}
+		_, isCall := n.(*calcrat.Call)
+		return !isCall
+	})
+	EQUALS(t, "rewritten identifiers outside of calls should be found", 1, count)
+}
@@ -1,77 +1,156 @@
 package calcrat
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
-	"regexp"
 	"strings"
-
-	"github.com/tamaxyo/go-utils/stack"
 )
 
-type priority int
+// DefaultMaxPowerBits is the default limit of the bit length of numerator and denominator of a power
+const DefaultMaxPowerBits = 1 << 20
+
+// scope holds the configuration of an evaluation and the values of identifiers resolved in it
+type scope struct {
+	formula      string
+	ctx          context.Context
+	resolver     Resolver
+	values       map[string]*big.Rat
+	functions    Functions
+	divZero      *big.Rat
+	approxPow    bool
+	maxPowerBits int
+	limits       Limits
+	steps        int
+}
+
+// canceled returns the error of the context if it is done
+func (s *scope) canceled() error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	default:
+		return nil
+	}
+}
 
-const (
-	high priority = iota
-	low
-)
+// text returns the part of the formula which n was parsed from
+func (s *scope) text(n interface{ bounds() (int, int) }) string {
+	pos, end := n.bounds()
+	return s.formula[pos:end]
+}
 
-// node is the interface that wraps val method.
+// node is the interface that wraps val and bounds methods.
+// bounds returns the byte offsets of the beginning and the end of the node in the formula.
 type node interface {
-	val() *big.Rat
+	val(s *scope) (*big.Rat, error)
+	bounds() (int, int)
 }
 
 // operator is the interface that groups basic functions of operator
 type operator interface {
+	node
 	setLeft(n node)
 	setRight(n node)
-	getPriority() priority
-	cmp(op operator) int
+	setPos(pos int)
 }
 
-var opMap map[string]func() operator = map[string]func() operator{
-	"+": newAdd,
-	"-": newSub,
-	"*": newMul,
-	"/": newDiv,
-	"&": newBitwiseAnd,
-	"|": newBitwiseOr,
-	"^": newBitwiseXor,
+type assoc int
+
+const (
+	leftAssoc assoc = iota
+	rightAssoc
+)
+
+// binaryOp describes precedence and associativity of a binary operator.
+// Higher precedence binds tighter.
+type binaryOp struct {
+	prec  int
+	assoc assoc
+	new   func() operator
+}
+
+// binaryOps is the precedence table of binary operators which follows the operator precedence of Go.
+// Conditional expression (?:) has lower precedence than any binary operator.
+var binaryOps = map[string]binaryOp{
+	"*":  {5, leftAssoc, newMul},
+	"/":  {5, leftAssoc, newDiv},
+	"%":  {5, leftAssoc, newMod},
+	"//": {5, leftAssoc, newFloorDiv},
+	"<<": {5, leftAssoc, newShiftLeft},
+	">>": {5, leftAssoc, newShiftRight},
+	"&":  {5, leftAssoc, newBitwiseAnd},
+	"+":  {4, leftAssoc, newAdd},
+	"-":  {4, leftAssoc, newSub},
+	"|":  {4, leftAssoc, newBitwiseOr},
+	"^":  {4, leftAssoc, newBitwiseXor},
+	"**": {prefixPrec + 1, rightAssoc, newPow},
+	"==": {3, leftAssoc, newEqual},
+	"!=": {3, leftAssoc, newNotEqual},
+	"<":  {3, leftAssoc, newLess},
+	"<=": {3, leftAssoc, newLessEqual},
+	">":  {3, leftAssoc, newGreater},
+	">=": {3, leftAssoc, newGreaterEqual},
+	"&&": {2, leftAssoc, newLogicalAnd},
+	"||": {1, leftAssoc, newLogicalOr},
+}
+
+// prefixPrec is the precedence of prefix operators.
+// Prefix operators bind tighter than any binary operator except power, so that -x**2 is -(x**2).
+const prefixPrec = 6
+
+// prefixOps holds operators which are accepted in the position of an operand.
+var prefixOps = map[string]func() operator{
+	"+": newPlus,
+	"-": newMinus,
+	"~": newBitwiseNot,
+	"^": newBitwiseNot,
+	"!": newLogicalNot,
 }
 
 type opBase struct {
-	pri   priority
+	pos   int
 	left  node
 	right node
 }
 
-// cmp returns the result of priority compiration
-//  1 : higher
-//  0 : same
-// -1 : lower
-func (a *opBase) cmp(b operator) int {
-	if b == nil {
-		return 1
-	}
+func (op *opBase) setLeft(n node) {
+	op.left = n
+}
 
-	if a.pri < b.getPriority() {
-		return 1
-	} else if a.pri > b.getPriority() {
-		return -1
-	}
-	return 0
+func (op *opBase) setRight(n node) {
+	op.right = n
 }
 
-func (op *opBase) getPriority() priority {
-	return op.pri
+func (op *opBase) setPos(pos int) {
+	op.pos = pos
 }
 
-func (op *opBase) setLeft(n node) {
-	op.left = n
+func (op *opBase) bounds() (int, int) {
+	pos := op.pos
+	if op.left != nil {
+		pos, _ = op.left.bounds()
+	}
+	_, end := op.right.bounds()
+	return pos, end
 }
 
-func (op *opBase) setRight(n node) {
-	op.right = n
+// operandVals evaluates both operands of binary operator
+func (op *opBase) operandVals(s *scope) (*big.Rat, *big.Rat, error) {
+	left, err := op.left.val(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err := op.right.val(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.canceled(); err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
 }
 
 type add struct {
@@ -79,12 +158,16 @@ type add struct {
 }
 
 func newAdd() operator {
-	return &add{&opBase{low, nil, nil}}
+	return &add{&opBase{}}
 }
 
-func (op *add) val() *big.Rat {
+func (op *add) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.operandVals(s)
+	if err != nil {
+		return nil, err
+	}
 	v := new(big.Rat)
-	return v.Add(op.left.val(), op.right.val())
+	return v.Add(left, right), nil
 }
 
 type sub struct {
@@ -92,12 +175,16 @@ type sub struct {
 }
 
 func newSub() operator {
-	return &sub{&opBase{low, nil, nil}}
+	return &sub{&opBase{}}
 }
 
-func (op *sub) val() *big.Rat {
+func (op *sub) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.operandVals(s)
+	if err != nil {
+		return nil, err
+	}
 	v := new(big.Rat)
-	return v.Sub(op.left.val(), op.right.val())
+	return v.Sub(left, right), nil
 }
 
 type mul struct {
@@ -105,12 +192,16 @@ type mul struct {
 }
 
 func newMul() operator {
-	return &mul{&opBase{high, nil, nil}}
+	return &mul{&opBase{}}
 }
 
-func (op *mul) val() *big.Rat {
+func (op *mul) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.operandVals(s)
+	if err != nil {
+		return nil, err
+	}
 	v := new(big.Rat)
-	return v.Mul(op.left.val(), op.right.val())
+	return v.Mul(left, right), nil
 }
 
 type div struct {
@@ -118,155 +209,456 @@ type div struct {
 }
 
 func newDiv() operator {
-	return &div{&opBase{high, nil, nil}}
+	return &div{&opBase{}}
 }
 
-func (op *div) val() *big.Rat {
+func (op *div) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.operandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	if right.Sign() == 0 {
+		if s.divZero != nil {
+			return new(big.Rat).Set(s.divZero), nil
+		}
+		return nil, &DivisionByZeroError{Expr: s.text(op.right)}
+	}
 	v := new(big.Rat)
-	inv := new(big.Rat)
-	return v.Mul(op.left.val(), inv.Inv(op.right.val()))
+	return v.Quo(left, right), nil
+}
+
+// pow represents exponentiation (**) operator.
+// pow computes exact powers for integer exponents. Non-integer exponents are accepted only in approximate mode.
+type pow struct {
+	*opBase
+}
+
+func newPow() operator {
+	return &pow{&opBase{}}
+}
+
+func (op *pow) val(s *scope) (*big.Rat, error) {
+	base, exp, err := op.operandVals(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exp.IsInt() && !s.approxPow {
+		return nil, fmt.Errorf("%w - %s", ErrNonIntegerExponent, s.text(op.right))
+	}
+	if base.Sign() == 0 && exp.Sign() < 0 {
+		if s.divZero != nil {
+			return new(big.Rat).Set(s.divZero), nil
+		}
+		return nil, &DivisionByZeroError{Expr: s.text(op.left)}
+	}
+
+	if !exp.IsInt() {
+		b, _ := base.Float64()
+		e, _ := exp.Float64()
+		f := math.Pow(b, e)
+		if math.IsNaN(f) {
+			// negative base with non-integer exponent has no real power
+			return nil, fmt.Errorf("%w - %s", ErrNaN, s.text(op))
+		}
+		if math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%w - %s", ErrPowerTooLarge, s.text(op))
+		}
+		v, _ := new(big.Rat).SetString(fmt.Sprint(f))
+		return v, nil
+	}
+
+	// reject before computing if the power obviously exceeds the limit
+	n := new(big.Int).Abs(exp.Num())
+	bits := base.Num().BitLen()
+	if b := base.Denom().BitLen(); b > bits {
+		bits = b
+	}
+	if bits > 1 && (!n.IsInt64() || n.Int64() > int64(s.maxPowerBits/(bits-1))) {
+		return nil, fmt.Errorf("%w - %s", ErrPowerTooLarge, s.text(op))
+	}
+
+	num := new(big.Int).Exp(base.Num(), n, nil)
+	den := new(big.Int).Exp(base.Denom(), n, nil)
+	if num.BitLen() > s.maxPowerBits || den.BitLen() > s.maxPowerBits {
+		return nil, fmt.Errorf("%w - %s", ErrPowerTooLarge, s.text(op))
+	}
+	if exp.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// intOperandVals evaluates both operands of binary operator which accepts only integers
+func (op *opBase) intOperandVals(s *scope) (*big.Int, *big.Int, error) {
+	left, right, err := op.operandVals(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !left.IsInt() {
+		return nil, nil, fmt.Errorf("%w - %s", ErrNonIntegerOperand, s.text(op.left))
+	}
+	if !right.IsInt() {
+		return nil, nil, fmt.Errorf("%w - %s", ErrNonIntegerOperand, s.text(op.right))
+	}
+	return left.Num(), right.Num(), nil
+}
+
+// divisor returns an error if right operand is zero.
+// The error is nil and fallback is returned if fallback for division by zero is set.
+func (op *opBase) divisor(s *scope, right *big.Int) (*big.Rat, error) {
+	if right.Sign() != 0 {
+		return nil, nil
+	}
+	if s.divZero != nil {
+		return new(big.Rat).Set(s.divZero), nil
+	}
+	return nil, &DivisionByZeroError{Expr: s.text(op.right)}
+}
+
+// mod represents remainder (%) operator.
+// mod truncates like Go, so that the result has the sign of left operand: -7 % 2 == -1.
+// Operands must be integers.
+type mod struct {
+	*opBase
+}
+
+func newMod() operator {
+	return &mod{&opBase{}}
+}
+
+func (op *mod) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := op.divisor(s, right); v != nil || err != nil {
+		return v, err
+	}
+	return new(big.Rat).SetInt(new(big.Int).Rem(left, right)), nil
+}
+
+// floorDiv represents integer division (//) operator.
+// floorDiv rounds toward negative infinity: -7 // 2 == -4.
+// Operands must be integers.
+type floorDiv struct {
+	*opBase
+}
+
+func newFloorDiv() operator {
+	return &floorDiv{&opBase{}}
+}
+
+func (op *floorDiv) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := op.divisor(s, right); v != nil || err != nil {
+		return v, err
+	}
+	return new(big.Rat).SetInt(floorInt(new(big.Rat).SetFrac(left, right))), nil
+}
+
+// shiftCount returns right operand as shift count
+func (op *opBase) shiftCount(s *scope, right *big.Int) (uint, error) {
+	if right.Sign() < 0 {
+		return 0, fmt.Errorf("negative shift count - %s", s.text(op.right))
+	}
+	if !right.IsInt64() || right.Int64() > int64(s.maxPowerBits) {
+		return 0, fmt.Errorf("%w - %s", ErrPowerTooLarge, s.text(op))
+	}
+	return uint(right.Int64()), nil
+}
+
+// shiftLeft represents left shift (<<) operator.
+// Operands must be integers and shift count must not be negative.
+type shiftLeft struct {
+	*opBase
+}
+
+func newShiftLeft() operator {
+	return &shiftLeft{&opBase{}}
+}
+
+func (op *shiftLeft) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	n, err := op.shiftCount(s, right)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetInt(new(big.Int).Lsh(left, n)), nil
+}
+
+// shiftRight represents arithmetic right shift (>>) operator, which rounds toward negative infinity like Go.
+// Operands must be integers and shift count must not be negative.
+type shiftRight struct {
+	*opBase
+}
+
+func newShiftRight() operator {
+	return &shiftRight{&opBase{}}
+}
+
+func (op *shiftRight) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	n, err := op.shiftCount(s, right)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetInt(new(big.Int).Rsh(left, n)), nil
 }
 
 // bitwiseAnd represents bitwise AND (&) operator.
-// bitwiseAnd casts operands to uint64, so that incorrect value will be returned unless operands are uint64 compatible
+// bitwiseAnd works on integers of arbitrary size with two's complement semantics for negative operands.
+// Operands must be integers.
 type bitwiseAnd struct {
 	*opBase
 }
 
 func newBitwiseAnd() operator {
-	return &bitwiseAnd{&opBase{high, nil, nil}}
+	return &bitwiseAnd{&opBase{}}
 }
 
-func (op *bitwiseAnd) val() *big.Rat {
-	left := op.left.val().Num().Uint64() / op.left.val().Denom().Uint64()
-	right := op.right.val().Num().Uint64() / op.right.val().Denom().Uint64()
-	i := new(big.Int).SetUint64(left & right)
-	return new(big.Rat).SetInt(i)
+func (op *bitwiseAnd) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetInt(new(big.Int).And(left, right)), nil
 }
 
 // bitwiseOr represents bitwise OR (|) operator.
-// bitwiseOr casts operors to uint64, so that incorrect value will be returned unless operors are uint64 compatible
+// bitwiseOr works on integers of arbitrary size with two's complement semantics for negative operands.
+// Operands must be integers.
 type bitwiseOr struct {
 	*opBase
 }
 
 func newBitwiseOr() operator {
-	return &bitwiseOr{&opBase{low, nil, nil}}
+	return &bitwiseOr{&opBase{}}
 }
 
-func (op *bitwiseOr) val() *big.Rat {
-	left := op.left.val().Num().Uint64() / op.left.val().Denom().Uint64()
-	right := op.right.val().Num().Uint64() / op.right.val().Denom().Uint64()
-	i := new(big.Int).SetUint64(left | right)
-	return new(big.Rat).SetInt(i)
+func (op *bitwiseOr) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetInt(new(big.Int).Or(left, right)), nil
 }
 
-// bitwiseXor represents bitwise XOR (^) operatxor.
-// bitwiseXor casts operxors to uint64, so that incxorrect value will be returned unless operxors are uint64 compatible
+// bitwiseXor represents bitwise XOR (^) operator.
+// bitwiseXor works on integers of arbitrary size with two's complement semantics for negative operands.
+// Operands must be integers.
 type bitwiseXor struct {
 	*opBase
 }
 
 func newBitwiseXor() operator {
-	return &bitwiseXor{&opBase{low, nil, nil}}
+	return &bitwiseXor{&opBase{}}
+}
+
+func (op *bitwiseXor) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.intOperandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).SetInt(new(big.Int).Xor(left, right)), nil
+}
+
+// plus represents unary plus (+) operator.
+type plus struct {
+	*opBase
+}
+
+func newPlus() operator {
+	return &plus{&opBase{}}
+}
+
+func (op *plus) val(s *scope) (*big.Rat, error) {
+	v, err := op.right.val(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Set(v), nil
 }
 
-func (op *bitwiseXor) val() *big.Rat {
-	left := op.left.val().Num().Uint64() / op.left.val().Denom().Uint64()
-	right := op.right.val().Num().Uint64() / op.right.val().Denom().Uint64()
-	i := new(big.Int).SetUint64(left ^ right)
-	return new(big.Rat).SetInt(i)
+// minus represents unary minus (-) operator.
+type minus struct {
+	*opBase
+}
+
+func newMinus() operator {
+	return &minus{&opBase{}}
+}
+
+func (op *minus) val(s *scope) (*big.Rat, error) {
+	v, err := op.right.val(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Neg(v), nil
+}
+
+// bitwiseNot represents bitwise complement (~ or unary ^) operator, which returns -x-1.
+// Operand must be an integer.
+type bitwiseNot struct {
+	*opBase
+}
+
+func newBitwiseNot() operator {
+	return &bitwiseNot{&opBase{}}
+}
+
+func (op *bitwiseNot) val(s *scope) (*big.Rat, error) {
+	v, err := op.right.val(s)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsInt() {
+		return nil, fmt.Errorf("%w - %s", ErrNonIntegerOperand, s.text(op.right))
+	}
+	return new(big.Rat).SetInt(new(big.Int).Not(v.Num())), nil
 }
 
 type literal struct {
-	v *big.Rat
+	v   *big.Rat
+	pos int
+	end int
 }
 
-func newLiteral(s string, variables Variables, handler Handler) (*literal, error) {
-	i := new(big.Int)
+// newLiteral returns a literal if s is a numeric literal.
+// See scanNumber for the syntax of numeric literals.
+func newLiteral(s string, pos int) (*literal, bool) {
 	l := &literal{
-		v: new(big.Rat),
+		pos: pos,
+		end: pos + len(s),
+	}
+	v, ok := parseNumber(s)
+	if !ok {
+		return nil, false
 	}
-	s = strings.TrimSpace(s)
+	l.v = v
+	return l, true
+}
 
-	// Check if literal is int to accept hex and octal literals
-	if _, ok := i.SetString(s, 0); ok {
-		l.v.SetInt(i)
-		return l, nil
+// parseNumber parses numeric literal s exactly
+func parseNumber(s string) (*big.Rat, bool) {
+	if strings.HasSuffix(s, "%") {
+		v, ok := parseNumber(s[:len(s)-1])
+		if !ok {
+			return nil, false
+		}
+		return v.Quo(v, big.NewRat(100, 1)), true
 	}
 
-	if _, ok := l.v.SetString(s); ok {
-		return l, nil
+	// Check if literal is int to accept binary, octal and hex literals with underscores
+	if i, ok := new(big.Int).SetString(s, 0); ok {
+		return new(big.Rat).SetInt(i), true
 	}
 
-	if v, ok := variables[s]; ok {
-		l.v = v
-		return l, nil
+	if !validUnderscores(s) {
+		return nil, false
+	}
+	s = strings.ReplaceAll(s, "_", "")
+	if v, ok := new(big.Rat).SetString(s); ok {
+		return v, true
 	}
+	return parseRepeating(s)
+}
 
-	if handler != nil {
-		if v := handler(s); v != nil {
-			l.v = v
-			return l, nil
+// validUnderscores reports whether each underscore in decimal literal s is placed between digits
+func validUnderscores(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' && (i == 0 || i+1 == len(s) || !isDigit(s[i-1]) || !isDigit(s[i+1])) {
+			return false
 		}
 	}
+	return true
+}
 
-	return nil, fmt.Errorf("could not parse string as rational - %s", s)
+func (l *literal) val(s *scope) (*big.Rat, error) {
+	return l.v, nil
 }
 
-func (l *literal) val() *big.Rat {
-	return l.v
+func (l *literal) bounds() (int, int) {
+	return l.pos, l.end
+}
+
+// ident represents a named value which is resolved on each evaluation
+type ident struct {
+	name string
+	pos  int
+}
+
+// val resolves the identifier on first use, so that identifiers in branches which are not taken are not resolved
+func (id *ident) val(s *scope) (*big.Rat, error) {
+	if v, ok := s.values[id.name]; ok {
+		return v, nil
+	}
+	if err := s.canceled(); err != nil {
+		return nil, err
+	}
+	v, err := s.resolver.Resolve(s.ctx, id.name)
+	var ue *UnknownIdentifierError
+	if errors.As(err, &ue) {
+		return nil, fmt.Errorf("could not parse literal in the formula - formula: %s. detail: [%w]", s.formula, err)
+	}
+	if err != nil {
+		return nil, &ResolveError{Name: id.name, Err: err}
+	}
+	if v == nil {
+		return nil, &ResolveError{Name: id.name, Err: fmt.Errorf("resolver returned nil")}
+	}
+	s.values[id.name] = v
+	return v, nil
+}
+
+func (id *ident) bounds() (int, int) {
+	return id.pos, id.pos + len(id.name)
+}
+
+// paren represents an expression enclosed in brackets
+type paren struct {
+	x      node
+	lparen int
+	rparen int
+}
+
+func (p *paren) val(s *scope) (*big.Rat, error) {
+	return p.x.val(s)
+}
+
+func (p *paren) bounds() (int, int) {
+	return p.lparen, p.rparen + 1
 }
 
 // Calc returns the calculated rational value from given formula with given variables
 func Calc(formula string, variables Variables, handler Handler) (*big.Rat, error) {
-	re := regexp.MustCompile("\\(|\\)|\\+|-|\\*|/|&|\\||\\^|[^\\(\\)\\+\\-\\*/&\\|\\^]+")
-	tokens := re.FindAllString(formula, -1)
-
-	opStack := stack.NewStack()
-	nodeStack := stack.NewStack()
-	bracket := stack.NewStack()
-
-	for _, token := range tokens {
-		if fn, ok := opMap[token]; ok {
-			op := fn()
-			if f := opStack.Peek(); f != nil && op.cmp(f.(operator)) < 1 {
-				prev := opStack.Pop().(operator)
-				prev.setRight(nodeStack.Pop().(node))
-				prev.setLeft(nodeStack.Pop().(node))
-				nodeStack.Push(prev)
-			}
-			opStack.Push(op)
-		} else if token == "(" {
-			bracket.Push(opStack)
-			opStack = stack.NewStack()
-		} else if token == ")" {
-			reduceBracket(opStack, nodeStack)
-			opStack = bracket.Pop().(*stack.Stack)
-
-		} else {
-			l, err := newLiteral(token, variables, handler)
-			if err == nil {
-				nodeStack.Push(l)
-			} else {
-				return nil, fmt.Errorf("could not parse literal in the formula - formula: %s. detail: [%s]", formula, err.Error())
-			}
-		}
-	}
-	reduceBracket(opStack, nodeStack)
+	return CalcFunctions(formula, variables, nil, handler)
+}
 
-	return nodeStack.Pop().(node).val(), nil
+// CalcFunctions returns the calculated rational value from given formula with given variables and functions
+func CalcFunctions(formula string, variables Variables, functions Functions, handler Handler) (*big.Rat, error) {
+	e, err := Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvalFunctions(variables, functions, handler)
 }
 
-func reduceBracket(opStack, nodeStack *stack.Stack) {
-	for {
-		p := opStack.Pop()
-		if p == nil {
-			return
-		}
-		op := p.(operator)
-		op.setRight(nodeStack.Pop().(node))
-		op.setLeft(nodeStack.Pop().(node))
-		nodeStack.Push(op)
+// CalcContext returns the calculated rational value from given formula with the values of identifiers given by resolver.
+// Evaluation stops with the error of ctx once ctx is done.
+func CalcContext(ctx context.Context, formula string, resolver Resolver) (*big.Rat, error) {
+	e, err := Compile(formula)
+	if err != nil {
+		return nil, err
 	}
+	return e.EvalContext(ctx, resolver, nil)
 }
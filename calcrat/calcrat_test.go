@@ -1,6 +1,8 @@
 package calcrat_test
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 	"testing"
 
@@ -347,3 +349,236 @@ func TestHandler(t *testing.T) {
 	EQUALS(t, "calc accepts formula with white space", 0, expected.Cmp(actual))
 	OK(t, err)
 }
+
+func TestCalcCanEvaluateUnaryMinus(t *testing.T) {
+	var expected *big.Rat
+	var actual *big.Rat
+	var err error
+	vars := map[string]*big.Rat{
+		"x": big.NewRat(3, 1),
+	}
+
+	expected = big.NewRat(2, 1)
+	actual, err = calcrat.Calc("-3+5", nil, nil)
+	EQUALS(t, "calc can evaluate leading unary minus", 0, expected.Cmp(actual))
+	OK(t, err)
+
+	expected = big.NewRat(-6, 1)
+	actual, err = calcrat.Calc("2*(-x)", vars, nil)
+	EQUALS(t, "calc can evaluate unary minus after bracket", 0, expected.Cmp(actual))
+	OK(t, err)
+
+	expected = big.NewRat(-5, 1)
+	actual, err = calcrat.Calc("2*-x+1", vars, nil)
+	EQUALS(t, "calc can evaluate unary minus after operator", 0, expected.Cmp(actual))
+	OK(t, err)
+
+	expected = big.NewRat(3, 1)
+	actual, err = calcrat.Calc("--x", vars, nil)
+	EQUALS(t, "calc can evaluate repeated unary minus", 0, expected.Cmp(actual))
+	OK(t, err)
+
+	expected = big.NewRat(-1, 2)
+	actual, err = calcrat.Calc("-(1/2)", nil, nil)
+	EQUALS(t, "calc can evaluate unary minus before bracket", 0, expected.Cmp(actual))
+	OK(t, err)
+
+	expected = big.NewRat(-9, 1)
+	actual, err = calcrat.Calc("1 - 2*3 - 4", nil, nil)
+	EQUALS(t, "calc can evaluate binary minus chain", 0, expected.Cmp(actual))
+	OK(t, err)
+}
+
+func TestCalcCanEvaluateUnaryPlus(t *testing.T) {
+	expected := big.NewRat(8, 1)
+	actual, err := calcrat.Calc("+3+(+5)", nil, nil)
+	EQUALS(t, "calc can evaluate unary plus", 0, expected.Cmp(actual))
+	OK(t, err)
+}
+
+func TestCalcCanEvaluateBitwiseNot(t *testing.T) {
+	var expected *big.Rat
+	var actual *big.Rat
+	var err error
+
+	expected = big.NewRat(-0x100, 1)
+	actual, err = calcrat.Calc("~0xFF", nil, nil)
+	EQUALS(t, "calc can evaluate bitwise not", 0, expected.Cmp(actual))
+	OK(t, err)
+
+	expected = big.NewRat(5, 1)
+	actual, err = calcrat.Calc("1+^-5", nil, nil)
+	EQUALS(t, "calc can evaluate bitwise not after operator", 0, expected.Cmp(actual))
+	OK(t, err)
+}
+
+func TestCalcCanEvaluatePower(t *testing.T) {
+	vars := map[string]*big.Rat{
+		"x": big.NewRat(3, 1),
+		"r": big.NewRat(1, 10),
+		"n": big.NewRat(3, 1),
+	}
+
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"x**2", "9"},
+		{"(1+r)**n", "1331/1000"},
+		{"2**3**2", "512"},
+		{"-x**2", "-9"},
+		{"(-x)**2", "9"},
+		{"2**-2", "1/4"},
+		{"(2/3)**-3", "27/8"},
+		{"(-2)**-3", "-1/8"},
+		{"x**0", "1"},
+		{"2*x**2+1", "19"},
+		{"1000*(1+r/12)**(12*n)", "955593817727321453093807642925081991552428315714137911219172409259950196321/708801874985091845381344307009569161216000000000000000000000000000000000"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Calc(c.formula, vars, nil)
+		OK(t, err)
+		EQUALS(t, "calc can evaluate power: "+c.formula, c.expected, actual.RatString())
+	}
+}
+
+func TestPowerErrors(t *testing.T) {
+	var err error
+
+	_, err = calcrat.Calc("2**(1/2)", nil, nil)
+	ASSERT(t, "error should be ErrNonIntegerExponent", errors.Is(err, calcrat.ErrNonIntegerExponent))
+
+	_, err = calcrat.Calc("0**-1", nil, nil)
+	ASSERT(t, "error should be ErrDivisionByZero", errors.Is(err, calcrat.ErrDivisionByZero))
+
+	_, err = calcrat.Calc("10**100000000", nil, nil)
+	ASSERT(t, "error should be ErrPowerTooLarge", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	e, err := calcrat.Compile("2**n")
+	OK(t, err)
+	_, err = e.WithMaxPowerBits(64).Eval(calcrat.Variables{"n": big.NewRat(64, 1)}, nil)
+	ASSERT(t, "error should be ErrPowerTooLarge", errors.Is(err, calcrat.ErrPowerTooLarge))
+	actual, err := e.WithMaxPowerBits(64).Eval(calcrat.Variables{"n": big.NewRat(63, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "power within limit should be evaluated", "9223372036854775808", actual.RatString())
+
+	actual, err = calcrat.Calc("1**100000000000", nil, nil)
+	OK(t, err)
+	EQUALS(t, "power of one should be evaluated", "1", actual.RatString())
+}
+
+func TestApproximatePower(t *testing.T) {
+	e, err := calcrat.Compile("4**(1/2)")
+	OK(t, err)
+
+	actual, err := e.WithApproximatePower().Eval(nil, nil)
+	OK(t, err)
+	EQUALS(t, "non-integer power should be approximated", "2", actual.RatString())
+
+	e, err = calcrat.Compile("(-8)**(1/3)")
+	OK(t, err)
+	_, err = e.WithApproximatePower().Eval(nil, nil)
+	ASSERT(t, "power without real value should be NaN", errors.Is(err, calcrat.ErrNaN))
+
+	e, err = calcrat.Compile("10**(1e400/3)")
+	OK(t, err)
+	_, err = e.WithApproximatePower().Eval(nil, nil)
+	ASSERT(t, "infinite power should be too large", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	e, err = calcrat.Compile("0**(-1/2)")
+	OK(t, err)
+	_, err = e.WithApproximatePower().Eval(nil, nil)
+	var de *calcrat.DivisionByZeroError
+	ASSERT(t, "negative power of zero should be division by zero", errors.As(err, &de))
+	EQUALS(t, "base should be reported", "0", de.Expr)
+}
+
+func TestCalcCanEvaluateIntegerOperators(t *testing.T) {
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"7 % 2", "1"},
+		{"-7 % 2", "-1"},
+		{"7 % -2", "1"},
+		{"7 // 2", "3"},
+		{"-7 // 2", "-4"},
+		{"7 // -2", "-4"},
+		{"-7 // -2", "3"},
+		{"1 << 4", "16"},
+		{"-1 << 4", "-16"},
+		{"0xFF >> 4", "15"},
+		{"-7 >> 1", "-4"},
+		{"1 + 2 << 3", "17"},
+		{"(1 + 2) << 3", "24"},
+		{"6/3 % 2", "0"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Calc(c.formula, nil, nil)
+		OK(t, err)
+		EQUALS(t, "calc can evaluate integer operator: "+c.formula, c.expected, actual.RatString())
+	}
+}
+
+func TestIntegerOperatorErrors(t *testing.T) {
+	for _, formula := range []string{"7/2 % 2", "7 % (1/2)", "7/2 // 1", "1/2 << 1", "1 >> (1/2)"} {
+		_, err := calcrat.Calc(formula, nil, nil)
+		ASSERT(t, "error should be ErrNonIntegerOperand: "+formula, errors.Is(err, calcrat.ErrNonIntegerOperand))
+	}
+
+	for _, formula := range []string{"7 % 0", "7 // (1-1)"} {
+		_, err := calcrat.Calc(formula, nil, nil)
+		ASSERT(t, "error should be ErrDivisionByZero: "+formula, errors.Is(err, calcrat.ErrDivisionByZero))
+	}
+
+	_, err := calcrat.Calc("1 << -1", nil, nil)
+	ASSERT(t, "error should not be nil", err != nil)
+
+	_, err = calcrat.Calc("1 << 100000000000", nil, nil)
+	ASSERT(t, "error should be ErrPowerTooLarge", errors.Is(err, calcrat.ErrPowerTooLarge))
+}
+
+func TestBitwiseOperatorsWithArbitraryPrecision(t *testing.T) {
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF & 0xF0F0F0F0F0F0F0F0F0F0F0F0F0F0F0F0", "0xf0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0"},
+		{"0xFFFFFFFFFFFFFFFF0000000000000000 | 0xFFFF", "0xffffffffffffffff000000000000ffff"},
+		{"0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF ^ 1", "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		{"((1 << 200) - 1) & 0xFF", "0xff"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Calc(c.formula, nil, nil)
+		OK(t, err)
+		EQUALS(t, "calc can evaluate wide bitwise operation: "+c.formula, c.expected, fmt.Sprintf("%#x", actual.Num()))
+	}
+
+	negatives := []struct {
+		formula  string
+		expected string
+	}{
+		{"-1 & 0xFF", "255"},
+		{"-16 | 3", "-13"},
+		{"-1 ^ 5", "-6"},
+		{"0xFF & ~0x0F", "240"},
+		{"0xFF &^0x0F", "240"},
+		{"-0x100 & -0x10", "-256"},
+	}
+
+	for _, c := range negatives {
+		actual, err := calcrat.Calc(c.formula, nil, nil)
+		OK(t, err)
+		EQUALS(t, "calc can evaluate bitwise operation of negative: "+c.formula, c.expected, actual.RatString())
+	}
+}
+
+func TestBitwiseOperatorsRejectFraction(t *testing.T) {
+	for _, formula := range []string{"1/2 & 1", "1 | 3/2", "0.5 ^ 1", "~(1/2)"} {
+		_, err := calcrat.Calc(formula, nil, nil)
+		ASSERT(t, "error should be ErrNonIntegerOperand: "+formula, errors.Is(err, calcrat.ErrNonIntegerOperand))
+	}
+}
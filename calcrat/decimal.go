@@ -0,0 +1,156 @@
+package calcrat
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// RoundingMode specifies how FormatDecimal rounds a value to the number of decimal places
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest neighbour and ties to the even neighbour
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest neighbour and ties away from zero
+	RoundHalfUp
+	// RoundDown rounds toward zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundFloor rounds toward negative infinity
+	RoundFloor
+	// RoundCeiling rounds toward positive infinity
+	RoundCeiling
+)
+
+// FormatDecimal returns r rounded to given number of decimal places with mode in decimal notation.
+// Negative digits round to tens, hundreds and so on.
+// FormatDecimal panics if mode is not one of the defined RoundingMode.
+func FormatDecimal(r *big.Rat, digits int, mode RoundingMode) string {
+	if mode < RoundHalfEven || mode > RoundCeiling {
+		panic(fmt.Sprintf("calcrat: invalid RoundingMode %d", int(mode)))
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs64(int64(digits)))), nil)
+	num := new(big.Int).Set(r.Num())
+	denom := new(big.Int).Set(r.Denom())
+	if digits >= 0 {
+		num.Mul(num, scale)
+	} else {
+		denom.Mul(denom, scale)
+	}
+
+	q, rem := new(big.Int).QuoRem(num, denom, new(big.Int))
+	if rem.Sign() != 0 {
+		half := new(big.Int).Lsh(new(big.Int).Abs(rem), 1).Cmp(denom)
+		away := false
+		switch mode {
+		case RoundHalfEven:
+			away = half > 0 || (half == 0 && q.Bit(0) == 1)
+		case RoundHalfUp:
+			away = half >= 0
+		case RoundUp:
+			away = true
+		case RoundFloor:
+			away = r.Sign() < 0
+		case RoundCeiling:
+			away = r.Sign() > 0
+		}
+		if away {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+
+	if digits <= 0 {
+		return q.Mul(q, scale).String()
+	}
+	sign := ""
+	if q.Sign() < 0 {
+		sign = "-"
+	}
+	s := q.Abs(q).String()
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// FormatRepeating returns the exact decimal notation of r with the repeating digits in brackets: 1/6 is 0.1(6).
+// The number of digits after the decimal point is proportional to the period, which can be as long as the denominator,
+// so that ErrTooManyDigits is returned if it exceeds maxDigits. Zero maxDigits means no limit.
+func FormatRepeating(r *big.Rat, maxDigits int) (string, error) {
+	sign := ""
+	if r.Sign() < 0 {
+		sign = "-"
+	}
+	denom := r.Denom()
+	q, rem := new(big.Int).QuoRem(new(big.Int).Abs(r.Num()), denom, new(big.Int))
+	if rem.Sign() == 0 {
+		return sign + q.String(), nil
+	}
+
+	d := new(big.Int).Set(denom)
+	pre := removeFactor(d, 2)
+	if fives := removeFactor(d, 5); fives > pre {
+		pre = fives
+	}
+
+	var b strings.Builder
+	b.WriteString(sign + q.String() + ".")
+	ten := big.NewInt(10)
+	digit := new(big.Int)
+	digits := 0
+	next := func() error {
+		if digits++; maxDigits > 0 && digits > maxDigits {
+			return fmt.Errorf("%w - %s has more than %d decimal places", ErrTooManyDigits, r.RatString(), maxDigits)
+		}
+		rem.Mul(rem, ten)
+		digit.QuoRem(rem, denom, rem)
+		b.WriteString(digit.String())
+		return nil
+	}
+	for i := 0; i < pre && rem.Sign() != 0; i++ {
+		if err := next(); err != nil {
+			return "", err
+		}
+	}
+	if rem.Sign() == 0 {
+		return b.String(), nil
+	}
+
+	b.WriteString("(")
+	start := new(big.Int).Set(rem)
+	for {
+		if err := next(); err != nil {
+			return "", err
+		}
+		if rem.Cmp(start) == 0 {
+			break
+		}
+	}
+	b.WriteString(")")
+	return b.String(), nil
+}
+
+var repeatingRe = regexp.MustCompile(`^([0-9]*)\.([0-9]*)\(([0-9]+)\)$`)
+
+// parseRepeating parses the decimal notation with the repeating digits in brackets such as 0.1(6)
+func parseRepeating(s string) (*big.Rat, bool) {
+	m := repeatingRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, false
+	}
+	ten := big.NewInt(10)
+
+	v := new(big.Rat)
+	if _, ok := v.SetString("0" + m[1] + "." + m[2] + "0"); !ok {
+		return nil, false
+	}
+	period, _ := new(big.Int).SetString(m[3], 10)
+	// the period is repeated right after the fraction: period / (10^len(fraction) * (10^len(period) - 1))
+	denom := new(big.Int).Exp(ten, big.NewInt(int64(len(m[3]))), nil)
+	denom.Sub(denom, big.NewInt(1))
+	denom.Mul(denom, new(big.Int).Exp(ten, big.NewInt(int64(len(m[2]))), nil))
+	return v.Add(v, new(big.Rat).SetFrac(period, denom)), true
+}
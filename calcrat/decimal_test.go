@@ -0,0 +1,108 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestFormatDecimalRoundsWithMode(t *testing.T) {
+	modes := []calcrat.RoundingMode{
+		calcrat.RoundHalfEven, calcrat.RoundHalfUp, calcrat.RoundDown,
+		calcrat.RoundUp, calcrat.RoundFloor, calcrat.RoundCeiling,
+	}
+	tests := []struct {
+		r      *big.Rat
+		digits int
+		exp    []string
+	}{
+		{big.NewRat(5, 2), 0, []string{"2", "3", "2", "3", "2", "3"}},
+		{big.NewRat(-5, 2), 0, []string{"-2", "-3", "-2", "-3", "-3", "-2"}},
+		{big.NewRat(7, 2), 0, []string{"4", "4", "3", "4", "3", "4"}},
+		{big.NewRat(2, 3), 2, []string{"0.67", "0.67", "0.66", "0.67", "0.66", "0.67"}},
+		{big.NewRat(-2, 3), 2, []string{"-0.67", "-0.67", "-0.66", "-0.67", "-0.67", "-0.66"}},
+		{big.NewRat(1, 8), 2, []string{"0.12", "0.13", "0.12", "0.13", "0.12", "0.13"}},
+		{big.NewRat(-1, 1000), 2, []string{"0.00", "0.00", "0.00", "-0.01", "-0.01", "0.00"}},
+		{big.NewRat(12, 1), 3, []string{"12.000", "12.000", "12.000", "12.000", "12.000", "12.000"}},
+		{big.NewRat(1250, 1), -2, []string{"1200", "1300", "1200", "1300", "1200", "1300"}},
+	}
+
+	for _, test := range tests {
+		for i, mode := range modes {
+			EQUALS(t, "value should be rounded: "+test.r.RatString(), test.exp[i], calcrat.FormatDecimal(test.r, test.digits, mode))
+		}
+	}
+}
+
+func TestFormatDecimalPanicsOnInvalidMode(t *testing.T) {
+	defer func() {
+		ASSERT(t, "invalid mode should panic", recover() != nil)
+	}()
+	calcrat.FormatDecimal(big.NewRat(1, 1), 0, calcrat.RoundCeiling+1)
+}
+
+func TestFormatRepeatingRoundTrips(t *testing.T) {
+	tests := []struct {
+		r   *big.Rat
+		exp string
+	}{
+		{big.NewRat(1, 3), "0.(3)"},
+		{big.NewRat(1, 6), "0.1(6)"},
+		{big.NewRat(-22, 7), "-3.(142857)"},
+		{big.NewRat(1, 8), "0.125"},
+		{big.NewRat(5, 1), "5"},
+		{big.NewRat(1, 12), "0.08(3)"},
+		{big.NewRat(1, 81), "0.(012345679)"},
+	}
+
+	for _, test := range tests {
+		s, err := calcrat.FormatRepeating(test.r, 100)
+		OK(t, err)
+		EQUALS(t, "repeating notation should be returned", test.exp, s)
+
+		v, err := calcrat.Calc(s, nil, nil)
+		OK(t, err)
+		EQUALS(t, "repeating notation should be parsed back: "+s, test.r.RatString(), v.RatString())
+	}
+}
+
+func TestFormatRepeatingLimitsDigits(t *testing.T) {
+	_, err := calcrat.FormatRepeating(big.NewRat(1, 1000003), 1000)
+	ASSERT(t, "long period should be rejected", errors.Is(err, calcrat.ErrTooManyDigits))
+
+	_, err = calcrat.FormatRepeating(big.NewRat(1, 7), 5)
+	ASSERT(t, "period exceeding max digits should be rejected", errors.Is(err, calcrat.ErrTooManyDigits))
+
+	s, err := calcrat.FormatRepeating(big.NewRat(1, 7), 6)
+	OK(t, err)
+	EQUALS(t, "period within max digits should be returned", "0.(142857)", s)
+
+	s, err = calcrat.FormatRepeating(big.NewRat(1, 7), 0)
+	OK(t, err)
+	EQUALS(t, "zero max digits should not limit", "0.(142857)", s)
+}
+
+func TestRepeatingLiteralsInFormulas(t *testing.T) {
+	tests := []struct {
+		formula string
+		exp     string
+	}{
+		{"0.(3) * 3", "1"},
+		{"1 - 0.(9)", "0"},
+		{".(142857)*7", "1"},
+		{"max(0.1(6), x) + 1.(3)", "3/2"},
+	}
+
+	for _, test := range tests {
+		v, err := calcrat.Calc(test.formula, calcrat.Variables{"x": big.NewRat(1, 8)}, nil)
+		OK(t, err)
+		EQUALS(t, "repeating literal should be evaluated: "+test.formula, test.exp, v.RatString())
+	}
+
+	s, err := calcrat.Format("0.1(6)+x")
+	OK(t, err)
+	EQUALS(t, "repeating literal should be kept as written", "0.1(6) + x", s)
+}
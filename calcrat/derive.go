@@ -0,0 +1,182 @@
+package calcrat
+
+import "strconv"
+
+// Derive returns the derivative of formula with respect to the variable of given name.
+// See (*Expression).Derive for the supported operations.
+func Derive(formula string, name string) (*Expression, error) {
+	e, err := Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	return e.Derive(name)
+}
+
+// Derive returns the simplified derivative of the expression with respect to the variable of given name.
+// Sub-expressions which do not depend on the variable are constant.
+// +, -, *, / and ** with constant exponents are differentiated as usual.
+// Conditional expressions differentiate the branches and keep the condition.
+// Comparison and logical operators, floor(), ceil() and round() are piecewise constant, so their derivatives are 0.
+// abs(), min() and max() are differentiated piecewise.
+// Other operators and functions return NotDifferentiableError.
+func (e *Expression) Derive(name string) (*Expression, error) {
+	d, err := derive(e.ast, name)
+	if err != nil {
+		return nil, err
+	}
+	c := *e
+	c.ast = d
+	return c.Simplify(nil)
+}
+
+func derive(x Expr, name string) (Expr, error) {
+	if !dependsOn(x, name) {
+		return num(0), nil
+	}
+
+	switch x := x.(type) {
+	case *Ident:
+		return num(1), nil
+	case *Paren:
+		return derive(x.X, name)
+	case *UnaryExpr:
+		if x.Op != "+" && x.Op != "-" {
+			return nil, &NotDifferentiableError{Expr: FormatExpr(x)}
+		}
+		d, err := derive(x.X, name)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: x.Op, X: d}, nil
+	case *BinaryExpr:
+		return deriveBinary(x, name)
+	case *Call:
+		return deriveCall(x, name)
+	case *CondExpr:
+		then, err := derive(x.Then, name)
+		if err != nil {
+			return nil, err
+		}
+		els, err := derive(x.Else, name)
+		if err != nil {
+			return nil, err
+		}
+		return &CondExpr{Cond: x.Cond, Then: then, Else: els}, nil
+	}
+	return nil, &NotDifferentiableError{Expr: FormatExpr(x)}
+}
+
+func deriveBinary(x *BinaryExpr, name string) (Expr, error) {
+	switch x.Op {
+	case "==", "!=", "<", "<=", ">", ">=", "&&", "||":
+		return num(0), nil
+	case "+", "-", "*", "/", "**":
+	default:
+		return nil, &NotDifferentiableError{Expr: FormatExpr(x)}
+	}
+
+	if x.Op == "**" {
+		if dependsOn(x.Y, name) {
+			return nil, &NotDifferentiableError{Expr: FormatExpr(x)}
+		}
+		du, err := derive(x.X, name)
+		if err != nil {
+			return nil, err
+		}
+		// n * u**(n-1) * du
+		n := &Paren{X: x.Y}
+		return bin(bin(n, "*", bin(x.X, "**", bin(n, "-", num(1)))), "*", du), nil
+	}
+
+	du, err := derive(x.X, name)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := derive(x.Y, name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "*":
+		return bin(bin(du, "*", x.Y), "+", bin(x.X, "*", dv)), nil
+	case "/":
+		// (du*v - u*dv) / v**2
+		return bin(bin(bin(du, "*", x.Y), "-", bin(x.X, "*", dv)), "/", bin(x.Y, "**", num(2))), nil
+	}
+	return bin(du, x.Op, dv), nil
+}
+
+func deriveCall(x *Call, name string) (Expr, error) {
+	switch x.Fun.Name {
+	case "floor", "ceil", "round":
+		return num(0), nil
+	case "abs":
+		if len(x.Args) != 1 {
+			break
+		}
+		d, err := derive(x.Args[0], name)
+		if err != nil {
+			return nil, err
+		}
+		return &CondExpr{Cond: bin(x.Args[0], "<", num(0)), Then: &UnaryExpr{Op: "-", X: d}, Else: d}, nil
+	case "min", "max":
+		if len(x.Args) == 0 {
+			break
+		}
+		return deriveExtremum(x.Fun.Name, x.Args, name)
+	case "if":
+		if len(x.Args) != 3 {
+			break
+		}
+		return derive(&CondExpr{Cond: x.Args[0], Then: x.Args[1], Else: x.Args[2]}, name)
+	}
+	return nil, &NotDifferentiableError{Expr: FormatExpr(x)}
+}
+
+// deriveExtremum differentiates min(a, rest...) as a <= min(rest...) ? da : d(min(rest...)) and max likewise
+func deriveExtremum(fn string, args []Expr, name string) (Expr, error) {
+	da, err := derive(args[0], name)
+	if err != nil || len(args) == 1 {
+		return da, err
+	}
+	var rest Expr = &Call{Fun: &Ident{Name: fn}, Args: args[1:]}
+	if len(args) == 2 {
+		rest = args[1]
+	}
+	drest, err := deriveExtremum(fn, args[1:], name)
+	if err != nil {
+		return nil, err
+	}
+	op := ">="
+	if fn == "min" {
+		op = "<="
+	}
+	return &CondExpr{Cond: bin(args[0], op, rest), Then: da, Else: drest}, nil
+}
+
+// dependsOn reports whether x refers to the variable of given name
+func dependsOn(x Expr, name string) bool {
+	found := false
+	Inspect(x, func(n Node) bool {
+		switch n := n.(type) {
+		case *Ident:
+			found = found || n.Name == name
+		case *Call:
+			for _, arg := range n.Args {
+				found = found || dependsOn(arg, name)
+			}
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+func num(i int64) Expr {
+	return &NumberLit{Value: strconv.FormatInt(i, 10)}
+}
+
+func bin(x Expr, op string, y Expr) Expr {
+	return &BinaryExpr{X: x, Op: op, Y: y}
+}
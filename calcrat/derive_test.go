@@ -0,0 +1,70 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestDeriveSimplifiesDerivative(t *testing.T) {
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"amount * rate", "amount"},
+		{"rate * amount + fee", "amount"},
+		{"amount", "0"},
+		{"rate", "1"},
+		{"-rate", "-1"},
+		{"rate ** 3", "3 * rate**2"},
+		{"rate*rate - 2*rate", "rate + rate - 2"},
+		{"(1 + rate) ** n", "n * (1 + rate)**(n - 1)"},
+		{"rate > 0 ? rate * 2 : 0", "rate > 0 ? 2 : 0"},
+		{"floor(rate) + (rate > 1)", "0"},
+		{"max(rate, 1) + tier(amount)", "rate >= 1 ? 1 : 0"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Derive(c.formula, "rate")
+		OK(t, err)
+		EQUALS(t, "derivative should be simplified: "+c.formula, c.expected, actual.String())
+	}
+}
+
+func TestDeriveCanBeEvaluated(t *testing.T) {
+	// d/dr (p * (1 + r)**n / ((1 + r)**n - 1)) at r = 1/10, n = 3
+	e, err := calcrat.Derive("p * (1 + r)**n / ((1 + r)**n - 1) + abs(r - 1)", "r")
+	OK(t, err)
+
+	vars := calcrat.Variables{
+		"p": big.NewRat(1000, 1),
+		"r": big.NewRat(1, 10),
+		"n": big.NewRat(3, 1),
+	}
+	actual, err := e.Eval(vars, nil)
+	OK(t, err)
+
+	// f = p*u/(u-1) with u = (1+r)**n, f' = -p*u'/(u-1)**2, u' = n*(1+r)**(n-1)
+	u := big.NewRat(1331, 1000)
+	du := big.NewRat(363, 100)
+	expected := new(big.Rat).Sub(u, big.NewRat(1, 1))
+	expected.Mul(expected, expected)
+	expected.Quo(new(big.Rat).Mul(big.NewRat(-1000, 1), du), expected)
+	expected.Sub(expected, big.NewRat(1, 1))
+	EQUALS(t, "derivative should be evaluated exactly", expected.RatString(), actual.RatString())
+}
+
+func TestDeriveReturnsNotDifferentiableError(t *testing.T) {
+	var ne *calcrat.NotDifferentiableError
+	for _, formula := range []string{"rate & 1", "rate | mask", "~rate", "rate % 2", "2 ** rate", "tier(rate)"} {
+		_, err := calcrat.Derive(formula, "rate")
+		ASSERT(t, "error should be NotDifferentiableError: "+formula, errors.As(err, &ne))
+	}
+
+	actual, err := calcrat.Derive("(mask & 0xFF) * rate", "rate")
+	OK(t, err)
+	EQUALS(t, "bitwise operation independent of variable should be constant", "mask & 0xFF", actual.String())
+}
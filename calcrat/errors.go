@@ -0,0 +1,201 @@
+package calcrat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDivisionByZero is returned when a divisor evaluates to zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrNonIntegerExponent is returned when an exponent is not an integer and approximate power is not enabled.
+var ErrNonIntegerExponent = errors.New("non-integer exponent")
+
+// ErrNonIntegerOperand is returned when an operator which accepts only integers is applied to a non-integer.
+var ErrNonIntegerOperand = errors.New("non-integer operand")
+
+// ErrPowerTooLarge is returned when the bit length of a power exceeds the limit.
+var ErrPowerTooLarge = errors.New("power too large")
+
+// ErrNonIntegerLiteral is returned when a literal is not an integer in IntDomain.
+var ErrNonIntegerLiteral = errors.New("non-integer literal")
+
+// ErrUnsupportedOperation is returned when an operator or a function is not supported by a Domain.
+var ErrUnsupportedOperation = errors.New("unsupported operation")
+
+// ErrNaN is returned when a floating-point operation results in NaN.
+var ErrNaN = errors.New("not a number")
+
+// ErrTooManyDigits is returned when the decimal notation of a value exceeds the number of digits.
+var ErrTooManyDigits = errors.New("too many digits")
+
+// SyntaxError describes a malformed formula.
+// Offset is the byte offset of Token in Formula. Token is empty when the formula ended unexpectedly.
+type SyntaxError struct {
+	Formula  string
+	Offset   int
+	Token    string
+	Expected string
+}
+
+func newSyntaxError(formula string, offset int, token, expected string) *SyntaxError {
+	return &SyntaxError{
+		Formula:  formula,
+		Offset:   offset,
+		Token:    token,
+		Expected: expected,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	found := "end of formula"
+	if e.Token != "" {
+		found = fmt.Sprintf("%q", e.Token)
+	}
+	return fmt.Sprintf("syntax error at offset %d in %q: unexpected %s, expected %s", e.Offset, e.Formula, found, e.Expected)
+}
+
+// InvalidLiteralError describes a numeric literal which could not be parsed as rational.
+type InvalidLiteralError struct {
+	Formula string
+	Offset  int
+	Literal string
+}
+
+func (e *InvalidLiteralError) Error() string {
+	return fmt.Sprintf("invalid literal %q at offset %d in %q", e.Literal, e.Offset, e.Formula)
+}
+
+// UnknownIdentifierError describes an identifier resolved by neither variables nor handler.
+type UnknownIdentifierError struct {
+	Name string
+}
+
+func (e *UnknownIdentifierError) Error() string {
+	return fmt.Sprintf("could not parse string as rational - %s", e.Name)
+}
+
+// ResolveError describes an error returned by Resolver for an identifier.
+type ResolveError struct {
+	Name string
+	Err  error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("could not resolve %s: %v", e.Name, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// LimitExceededError describes a formula which exceeded a limit of Limits.
+// Limit is the name of the field of Limits and Expr is the part of the formula whose value exceeded MaxBits.
+type LimitExceededError struct {
+	Limit string
+	Max   int
+	Expr  string
+}
+
+func (e *LimitExceededError) Error() string {
+	if e.Expr != "" {
+		return fmt.Sprintf("limit exceeded - %s %d by %s", e.Limit, e.Max, e.Expr)
+	}
+	return fmt.Sprintf("limit exceeded - %s %d", e.Limit, e.Max)
+}
+
+// DimensionError describes operands whose dimensions are not allowed for the operation.
+// Right is zero for unary operations and functions.
+type DimensionError struct {
+	Expr  string
+	Left  Dimension
+	Right Dimension
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("dimension mismatch - %s: %s and %s", e.Expr, e.Left, e.Right)
+}
+
+// UnknownUnitError describes a unit which is not defined in Units.
+type UnknownUnitError struct {
+	Name string
+}
+
+func (e *UnknownUnitError) Error() string {
+	return fmt.Sprintf("unknown unit - %s", e.Name)
+}
+
+// DivisionByZeroError describes a divisor which evaluated to zero.
+// Expr is the part of the formula of the divisor.
+type DivisionByZeroError struct {
+	Expr string
+}
+
+func (e *DivisionByZeroError) Error() string {
+	return fmt.Sprintf("%s - %s evaluated to zero", ErrDivisionByZero.Error(), e.Expr)
+}
+
+// Unwrap returns ErrDivisionByZero so that errors.Is can be used.
+func (e *DivisionByZeroError) Unwrap() error {
+	return ErrDivisionByZero
+}
+
+// DivisorContainsZeroError describes a divisor whose interval contains zero.
+// Expr is the part of the formula of the divisor.
+type DivisorContainsZeroError struct {
+	Expr    string
+	Divisor Interval
+}
+
+func (e *DivisorContainsZeroError) Error() string {
+	return fmt.Sprintf("%s - %s in %s contains zero", ErrDivisionByZero.Error(), e.Expr, e.Divisor)
+}
+
+// Unwrap returns ErrDivisionByZero so that errors.Is can be used.
+func (e *DivisorContainsZeroError) Unwrap() error {
+	return ErrDivisionByZero
+}
+
+// UnknownFunctionError describes a function found in neither functions nor built-in functions.
+type UnknownFunctionError struct {
+	Name string
+}
+
+func (e *UnknownFunctionError) Error() string {
+	return fmt.Sprintf("unknown function - %s", e.Name)
+}
+
+// ArityError describes a function call with wrong number of arguments.
+type ArityError struct {
+	Name     string
+	Arity    int
+	Variadic bool
+	Args     int
+}
+
+func (e *ArityError) Error() string {
+	if e.Variadic {
+		return fmt.Sprintf("function %s takes at least %d arguments but %d given", e.Name, e.Arity, e.Args)
+	}
+	return fmt.Sprintf("function %s takes %d arguments but %d given", e.Name, e.Arity, e.Args)
+}
+
+// NotDifferentiableError describes a sub-expression which could not be differentiated.
+type NotDifferentiableError struct {
+	Expr string
+}
+
+func (e *NotDifferentiableError) Error() string {
+	return fmt.Sprintf("not differentiable - %s", e.Expr)
+}
+
+// CycleError describes cells of a sheet which refer to each other.
+// Path starts and ends with the same cell.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("cycle detected - %s", strings.Join(e.Path, " -> "))
+}
@@ -0,0 +1,98 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestMalformedFormulaReturnsSyntaxError(t *testing.T) {
+	cases := []struct {
+		formula  string
+		offset   int
+		token    string
+		expected string
+	}{
+		{"", 0, "", "operand"},
+		{"   ", 3, "", "operand"},
+		{"1+", 2, "", "operand"},
+		{"(1+2", 4, "", ")"},
+		{"1+2)", 3, ")", "operator or end of formula"},
+		{"*3", 0, "*", "operand"},
+		{"1 + * 2", 4, "*", "operand"},
+		{"()", 1, ")", "operand"},
+		{"2(3)", 1, "(", "operator"},
+		{"(1)2", 3, "2", "operator"},
+	}
+
+	for _, c := range cases {
+		_, err := calcrat.Calc(c.formula, nil, nil)
+		var se *calcrat.SyntaxError
+		ASSERT(t, "error should be SyntaxError: "+c.formula, errors.As(err, &se))
+		EQUALS(t, "offset should match: "+c.formula, c.offset, se.Offset)
+		EQUALS(t, "token should match: "+c.formula, c.token, se.Token)
+		EQUALS(t, "expected should match: "+c.formula, c.expected, se.Expected)
+	}
+}
+
+func TestInvalidLiteralReturnsInvalidLiteralError(t *testing.T) {
+	_, err := calcrat.Compile("1 + 0xXX")
+	var le *calcrat.InvalidLiteralError
+	ASSERT(t, "error should be InvalidLiteralError", errors.As(err, &le))
+	EQUALS(t, "offset should match", 4, le.Offset)
+	EQUALS(t, "literal should match", "0xXX", le.Literal)
+
+	_, err = calcrat.Compile("1 2+3")
+	ASSERT(t, "error should be InvalidLiteralError", errors.As(err, &le))
+	EQUALS(t, "offset should match", 0, le.Offset)
+	EQUALS(t, "literal should match", "1 2", le.Literal)
+}
+
+func TestUnknownIdentifierReturnsUnknownIdentifierError(t *testing.T) {
+	_, err := calcrat.Calc("one+four", calcrat.Variables{"one": big.NewRat(1, 1)}, nil)
+	var ue *calcrat.UnknownIdentifierError
+	ASSERT(t, "error should be UnknownIdentifierError", errors.As(err, &ue))
+	EQUALS(t, "name should match", "four", ue.Name)
+}
+
+func TestDivisionByZeroReturnsError(t *testing.T) {
+	vars := calcrat.Variables{
+		"x": big.NewRat(0, 1),
+		"y": big.NewRat(3, 1),
+	}
+
+	_, err := calcrat.Calc("1/x", vars, nil)
+	ASSERT(t, "error should be ErrDivisionByZero", errors.Is(err, calcrat.ErrDivisionByZero))
+
+	_, err = calcrat.Calc("y + 1/( y - 3 )", vars, nil)
+	var de *calcrat.DivisionByZeroError
+	ASSERT(t, "error should be DivisionByZeroError", errors.As(err, &de))
+	EQUALS(t, "expr should be the divisor", "( y - 3 )", de.Expr)
+
+	_, err = calcrat.Calc("1/(x*y)+2", vars, nil)
+	ASSERT(t, "error should be DivisionByZeroError", errors.As(err, &de))
+	EQUALS(t, "expr should be the divisor", "(x*y)", de.Expr)
+
+	_, err = calcrat.Calc("1/-x", vars, nil)
+	ASSERT(t, "error should be DivisionByZeroError", errors.As(err, &de))
+	EQUALS(t, "expr should be the divisor", "-x", de.Expr)
+}
+
+func TestDivisionByZeroFallback(t *testing.T) {
+	e, err := calcrat.Compile("y + 1/x")
+	OK(t, err)
+
+	vars := calcrat.Variables{
+		"x": big.NewRat(0, 1),
+		"y": big.NewRat(3, 1),
+	}
+	actual, err := e.WithDivisionByZero(big.NewRat(0, 1)).Eval(vars, nil)
+	EQUALS(t, "division by zero should be evaluated to fallback", "3", actual.RatString())
+	OK(t, err)
+
+	_, err = e.Eval(vars, nil)
+	ASSERT(t, "original expression should not be affected", errors.Is(err, calcrat.ErrDivisionByZero))
+}
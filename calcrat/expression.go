@@ -0,0 +1,300 @@
+package calcrat
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+// Expression is a compiled formula.
+// Expression is immutable so that it can be evaluated from multiple goroutines concurrently.
+type Expression struct {
+	formula string
+	ast     Expr
+	root    node
+	idents  []string
+	names   []string
+	funcs   []string
+	divZero *big.Rat
+
+	approxPow    bool
+	maxPowerBits int
+	limits       Limits
+}
+
+// Compile parses given formula and returns an Expression which can be evaluated many times
+func Compile(formula string) (*Expression, error) {
+	return CompileLimits(formula, Limits{})
+}
+
+// CompileLimits parses given formula within limits and returns an Expression which is evaluated within limits
+func CompileLimits(formula string, limits Limits) (*Expression, error) {
+	x, err := ParseLimits(formula, limits)
+	if err != nil {
+		return nil, err
+	}
+	root, err := build(formula, x, limits.evaluated())
+	if err != nil {
+		return nil, err
+	}
+	idents, names, funcs := references(x)
+	e := &Expression{
+		formula: formula,
+		ast:     x,
+		root:    root,
+		idents:  idents,
+		names:   names,
+		funcs:   funcs,
+
+		maxPowerBits: DefaultMaxPowerBits,
+		limits:       limits,
+	}
+	if limits.MaxBits > 0 && limits.MaxBits < e.maxPowerBits {
+		e.maxPowerBits = limits.MaxBits
+	}
+	return e, nil
+}
+
+// build converts the AST of formula into the tree of nodes to be evaluated.
+// If limit is true, each node is wrapped to enforce the limits on evaluation.
+func build(formula string, x Expr, limit bool) (node, error) {
+	n, err := buildNode(formula, x, limit)
+	if err != nil || !limit {
+		return n, err
+	}
+	return &limited{n}, nil
+}
+
+func buildNode(formula string, x Expr, limit bool) (node, error) {
+	switch x := x.(type) {
+	case *NumberLit:
+		l, ok := newLiteral(x.Value, x.ValuePos)
+		if !ok {
+			return nil, &InvalidLiteralError{Formula: formula, Offset: x.ValuePos, Literal: x.Value}
+		}
+		return l, nil
+	case *UnitLit:
+		// unit literals can be evaluated only by Units
+		return nil, &InvalidLiteralError{Formula: formula, Offset: x.Pos(), Literal: formula[x.Pos():x.End()]}
+	case *Ident:
+		return &ident{x.Name, x.NamePos}, nil
+	case *UnaryExpr:
+		fn, ok := prefixOps[x.Op]
+		if !ok {
+			return nil, fmt.Errorf("unknown prefix operator %q", x.Op)
+		}
+		right, err := build(formula, x.X, limit)
+		if err != nil {
+			return nil, err
+		}
+		op := fn()
+		op.setPos(x.OpPos)
+		op.setRight(right)
+		return op, nil
+	case *BinaryExpr:
+		b, ok := binaryOps[x.Op]
+		if !ok {
+			return nil, fmt.Errorf("unknown binary operator %q", x.Op)
+		}
+		left, err := build(formula, x.X, limit)
+		if err != nil {
+			return nil, err
+		}
+		right, err := build(formula, x.Y, limit)
+		if err != nil {
+			return nil, err
+		}
+		op := b.new()
+		op.setPos(x.OpPos)
+		op.setLeft(left)
+		op.setRight(right)
+		return op, nil
+	case *Paren:
+		inner, err := build(formula, x.X, limit)
+		if err != nil {
+			return nil, err
+		}
+		return &paren{inner, x.Lparen, x.Rparen}, nil
+	case *Call:
+		args := make([]node, len(x.Args))
+		for i, arg := range x.Args {
+			n, err := build(formula, arg, limit)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = n
+		}
+		// if is not a function but a conditional expression so that only the taken branch is evaluated
+		if x.Fun.Name == "if" {
+			if len(args) != 3 {
+				return nil, &ArityError{Name: x.Fun.Name, Arity: 3, Args: len(args)}
+			}
+			return &conditional{args[0], args[1], args[2], x.Pos(), x.End()}, nil
+		}
+		return &call{x.Fun.Name, x.Fun.NamePos, args, x.Rparen}, nil
+	case *CondExpr:
+		c, err := build(formula, x.Cond, limit)
+		if err != nil {
+			return nil, err
+		}
+		then, err := build(formula, x.Then, limit)
+		if err != nil {
+			return nil, err
+		}
+		els, err := build(formula, x.Else, limit)
+		if err != nil {
+			return nil, err
+		}
+		return &conditional{c, then, els, x.Pos(), x.End()}, nil
+	}
+	return nil, fmt.Errorf("unknown expression %T", x)
+}
+
+// references returns the names referenced in x in first-use order.
+// It returns all names, the names of identifiers and the names of functions.
+func references(x Expr) ([]string, []string, []string) {
+	idents := []string{}
+	names := []string{}
+	funcs := []string{}
+	seen := map[string]bool{}
+	seenNames := map[string]bool{}
+	seenFuncs := map[string]bool{}
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			idents = append(idents, name)
+		}
+	}
+
+	var f func(Node) bool
+	f = func(n Node) bool {
+		switch n := n.(type) {
+		case *Ident:
+			add(n.Name)
+			if !seenNames[n.Name] {
+				seenNames[n.Name] = true
+				names = append(names, n.Name)
+			}
+		case *Call:
+			if n.Fun.Name != "if" {
+				add(n.Fun.Name)
+				if !seenFuncs[n.Fun.Name] {
+					seenFuncs[n.Fun.Name] = true
+					funcs = append(funcs, n.Fun.Name)
+				}
+			}
+			for _, arg := range n.Args {
+				Inspect(arg, f)
+			}
+			return false
+		}
+		return true
+	}
+	Inspect(x, f)
+
+	return idents, names, funcs
+}
+
+// Identifiers returns the names of variables and functions referenced in given formula in first-use order.
+// Neither variables nor handler is consulted.
+func Identifiers(formula string) ([]string, error) {
+	x, err := Parse(formula)
+	if err != nil {
+		return nil, err
+	}
+	idents, _, _ := references(x)
+	return idents, nil
+}
+
+// Eval returns the calculated rational value of the expression with given variables
+func (e *Expression) Eval(variables Variables, handler Handler) (*big.Rat, error) {
+	return e.EvalFunctions(variables, nil, handler)
+}
+
+// EvalFunctions returns the calculated rational value of the expression with given variables and functions.
+// Functions take precedence over the built-in functions of the same name.
+func (e *Expression) EvalFunctions(variables Variables, functions Functions, handler Handler) (*big.Rat, error) {
+	return e.EvalContext(context.Background(), Chain(variables, handler), functions)
+}
+
+// EvalContext returns the calculated rational value of the expression with the values of identifiers given by resolver
+// and functions. Each identifier is resolved at most once per evaluation.
+// Errors of resolver other than UnknownIdentifierError are returned as ResolveError.
+// Evaluation stops with the error of ctx once ctx is done. nil resolver knows no identifiers.
+func (e *Expression) EvalContext(ctx context.Context, resolver Resolver, functions Functions) (*big.Rat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if resolver == nil {
+		resolver = Variables{}
+	}
+	s := &scope{
+		formula:   e.formula,
+		ctx:       ctx,
+		resolver:  resolver,
+		values:    make(map[string]*big.Rat, len(e.names)),
+		functions: functions,
+		divZero:   e.divZero,
+
+		approxPow:    e.approxPow,
+		maxPowerBits: e.maxPowerBits,
+		limits:       e.limits,
+	}
+
+	v, err := e.root.val(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Set(v), nil
+}
+
+// WithDivisionByZero returns a copy of the expression which evaluates division by zero to fallback
+// instead of returning ErrDivisionByZero
+func (e *Expression) WithDivisionByZero(fallback *big.Rat) *Expression {
+	c := *e
+	c.divZero = new(big.Rat).Set(fallback)
+	return &c
+}
+
+// WithApproximatePower returns a copy of the expression which approximates powers with non-integer exponents
+// by float64 instead of returning ErrNonIntegerExponent
+func (e *Expression) WithApproximatePower() *Expression {
+	c := *e
+	c.approxPow = true
+	return &c
+}
+
+// WithMaxPowerBits returns a copy of the expression which limits the bit length of numerator and denominator
+// of powers to bits instead of DefaultMaxPowerBits
+func (e *Expression) WithMaxPowerBits(bits int) *Expression {
+	c := *e
+	c.maxPowerBits = bits
+	return &c
+}
+
+// Identifiers returns the names of variables and functions referenced in the expression in first-use order
+func (e *Expression) Identifiers() []string {
+	return append([]string{}, e.idents...)
+}
+
+// VariableNames returns the names of variables referenced in the expression in first-use order
+func (e *Expression) VariableNames() []string {
+	return append([]string{}, e.names...)
+}
+
+// FunctionNames returns the names of functions called in the expression in first-use order.
+// if is not included since it is a conditional expression.
+func (e *Expression) FunctionNames() []string {
+	return append([]string{}, e.funcs...)
+}
+
+// AST returns the AST of the expression. The AST must not be modified.
+func (e *Expression) AST() Expr {
+	return e.ast
+}
+
+// String returns the canonical form of the expression
+func (e *Expression) String() string {
+	return FormatExpr(e.ast)
+}
@@ -0,0 +1,131 @@
+package calcrat_test
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+const benchFormula = "(price*quantity-discount)*(100+tax)/100"
+
+func TestCompiledExpressionCanBeEvaluatedRepeatedly(t *testing.T) {
+	e, err := calcrat.Compile("one+two*three")
+	OK(t, err)
+
+	actual, err := e.Eval(calcrat.Variables{"one": big.NewRat(1, 1), "two": big.NewRat(2, 1), "three": big.NewRat(3, 1)}, nil)
+	EQUALS(t, "expression can be evaluated with first variables", "7", actual.RatString())
+	OK(t, err)
+
+	actual, err = e.Eval(calcrat.Variables{"one": big.NewRat(1, 2), "two": big.NewRat(1, 3)}, func(name string) *big.Rat {
+		if name == "three" {
+			return big.NewRat(3, 1)
+		}
+		return nil
+	})
+	EQUALS(t, "expression can be evaluated with second variables", "3/2", actual.RatString())
+	OK(t, err)
+
+	_, err = e.Eval(calcrat.Variables{"one": big.NewRat(1, 1)}, nil)
+	ASSERT(t, "error should not be nil", err != nil)
+}
+
+func TestCompiledExpressionIsNotModifiedByResult(t *testing.T) {
+	e, err := calcrat.Compile("100")
+	OK(t, err)
+
+	actual, err := e.Eval(nil, nil)
+	OK(t, err)
+	actual.SetInt64(0)
+
+	actual, err = e.Eval(nil, nil)
+	EQUALS(t, "result should be a copy", "100", actual.RatString())
+	OK(t, err)
+}
+
+func TestCompiledExpressionCanBeEvaluatedConcurrently(t *testing.T) {
+	e, err := calcrat.Compile("x*x-1")
+	OK(t, err)
+
+	var wg sync.WaitGroup
+	results := make([]*big.Rat, 100)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = e.Eval(calcrat.Variables{"x": big.NewRat(int64(i), 1)}, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, actual := range results {
+		expected := big.NewRat(int64(i*i-1), 1)
+		EQUALS(t, "concurrent evaluation should not interfere", 0, expected.Cmp(actual))
+	}
+}
+
+func benchVariables() calcrat.Variables {
+	return calcrat.Variables{
+		"price":    big.NewRat(1999, 100),
+		"quantity": big.NewRat(12, 1),
+		"discount": big.NewRat(5, 1),
+		"tax":      big.NewRat(8, 1),
+	}
+}
+
+func BenchmarkCalc(b *testing.B) {
+	vars := benchVariables()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := calcrat.Calc(benchFormula, vars, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompileAndEval(b *testing.B) {
+	vars := benchVariables()
+	e, err := calcrat.Compile(benchFormula)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(vars, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIdentifiersAreListedInFirstUseOrder(t *testing.T) {
+	formula := "subtotal * (1 + tax) + max(shipping, minShipping) - if(vip, discount(subtotal), 0) + tax"
+
+	actual, err := calcrat.Identifiers(formula)
+	OK(t, err)
+	EQUALS(t, "identifiers should be listed in first-use order",
+		[]string{"subtotal", "tax", "max", "shipping", "minShipping", "vip", "discount"}, actual)
+
+	e, err := calcrat.Compile(formula)
+	OK(t, err)
+	EQUALS(t, "identifiers of expression should match", actual, e.Identifiers())
+	EQUALS(t, "variable names should be listed in first-use order",
+		[]string{"subtotal", "tax", "shipping", "minShipping", "vip"}, e.VariableNames())
+	EQUALS(t, "function names should be listed in first-use order",
+		[]string{"max", "discount"}, e.FunctionNames())
+}
+
+func TestIdentifiersDoNotResolveValues(t *testing.T) {
+	actual, err := calcrat.Identifiers("1/x + 0xFF")
+	OK(t, err)
+	EQUALS(t, "identifiers should be listed without evaluation", []string{"x"}, actual)
+
+	actual, err = calcrat.Identifiers("1 + 2")
+	OK(t, err)
+	EQUALS(t, "no identifiers should be listed", []string{}, actual)
+
+	_, err = calcrat.Identifiers("1 +")
+	ASSERT(t, "error should not be nil", err != nil)
+}
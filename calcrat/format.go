@@ -0,0 +1,158 @@
+package calcrat
+
+import "strings"
+
+// Format parses given formula and returns it in canonical form.
+// See FormatExpr for the canonical form.
+func Format(formula string) (string, error) {
+	x, err := Parse(formula)
+	if err != nil {
+		return "", err
+	}
+	return FormatExpr(x), nil
+}
+
+// FormatExpr returns the canonical form of x.
+// Brackets are emitted only where required by precedence and associativity, and literals are kept as written.
+// Like gofmt, binary operators are surrounded by spaces except for arithmetic operators
+// which bind tighter than another operator in the same expression: one + two*three.
+func FormatExpr(x Expr) string {
+	p := &printer{}
+	p.expr(x)
+	return p.String()
+}
+
+type printer struct {
+	strings.Builder
+}
+
+// unparen removes brackets around x since brackets are emitted only where required
+func unparen(x Expr) Expr {
+	for {
+		p, ok := x.(*Paren)
+		if !ok {
+			return x
+		}
+		x = p.X
+	}
+}
+
+// expr prints x as the root of an expression
+func (p *printer) expr(x Expr) {
+	switch x := unparen(x).(type) {
+	case *NumberLit:
+		p.WriteString(x.Value)
+	case *UnitLit:
+		p.WriteString(x.Number.Value + " " + x.Unit)
+	case *Ident:
+		p.WriteString(x.Name)
+	case *UnaryExpr:
+		p.WriteString(x.Op)
+		operand := unparen(x.X)
+		switch o := operand.(type) {
+		case *CondExpr:
+			p.paren(o)
+		case *BinaryExpr:
+			if binaryOps[o.Op].prec <= prefixPrec {
+				p.paren(o)
+			} else {
+				p.expr(o)
+			}
+		default:
+			p.expr(o)
+		}
+	case *BinaryExpr:
+		p.binary(x, chainPrec(x))
+	case *Call:
+		p.WriteString(x.Fun.Name)
+		p.WriteString("(")
+		for i, arg := range x.Args {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.expr(arg)
+		}
+		p.WriteString(")")
+	case *CondExpr:
+		if _, ok := unparen(x.Cond).(*CondExpr); ok {
+			p.paren(x.Cond)
+		} else {
+			p.expr(x.Cond)
+		}
+		p.WriteString(" ? ")
+		p.expr(x.Then)
+		p.WriteString(" : ")
+		p.expr(x.Else)
+	}
+}
+
+func (p *printer) paren(x Expr) {
+	p.WriteString("(")
+	p.expr(x)
+	p.WriteString(")")
+}
+
+// binary prints x as a part of the chain of binary operations whose lowest precedence is minPrec
+func (p *printer) binary(x *BinaryExpr, minPrec int) {
+	p.operand(x, x.X, true, minPrec)
+	// an operator directly after a percent literal such as 15%-2, or remainder directly after a number,
+	// would be ambiguous between percent and remainder
+	percent := strings.HasSuffix(p.String(), "%") || x.Op == "%"
+	if prec := binaryOps[x.Op].prec; prec > minPrec && prec >= binaryOps["+"].prec && !percent {
+		p.WriteString(x.Op)
+	} else {
+		p.WriteString(" " + x.Op + " ")
+	}
+	p.operand(x, x.Y, false, minPrec)
+}
+
+func (p *printer) operand(parent *BinaryExpr, x Expr, left bool, minPrec int) {
+	x = unparen(x)
+	if needsParen(parent, x, left) {
+		p.paren(x)
+	} else if b, ok := x.(*BinaryExpr); ok {
+		p.binary(b, minPrec)
+	} else {
+		p.expr(x)
+	}
+}
+
+// needsParen reports whether operand x of parent must be enclosed in brackets
+func needsParen(parent *BinaryExpr, x Expr, left bool) bool {
+	pb := binaryOps[parent.Op]
+	switch x := unparen(x).(type) {
+	case *CondExpr:
+		return true
+	case *UnaryExpr:
+		// -x**2 is -(x**2)
+		return left && pb.prec > prefixPrec
+	case *UnitLit:
+		// 3 m**2 is rejected as ambiguous
+		return left && parent.Op == "**"
+	case *BinaryExpr:
+		xb := binaryOps[x.Op]
+		if xb.prec != pb.prec {
+			return xb.prec < pb.prec
+		}
+		if left {
+			return pb.assoc == rightAssoc
+		}
+		return pb.assoc == leftAssoc
+	}
+	return false
+}
+
+// chainPrec returns the lowest precedence of the binary operations printed without brackets from x
+func chainPrec(x *BinaryExpr) int {
+	prec := binaryOps[x.Op].prec
+	for i, operand := range []Expr{x.X, x.Y} {
+		b, ok := unparen(operand).(*BinaryExpr)
+		if !ok || needsParen(x, b, i == 0) {
+			continue
+		}
+		if p := chainPrec(b); p < prec {
+			prec = p
+		}
+	}
+	return prec
+}
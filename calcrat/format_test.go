@@ -0,0 +1,93 @@
+package calcrat_test
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestFormatPrintsCanonicalForm(t *testing.T) {
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{" one+  two*(three) ", "one + two*three"},
+		{"((a))", "a"},
+		{"a*b", "a * b"},
+		{"(a+b)*c", "(a + b) * c"},
+		{"a-(b-c)", "a - (b - c)"},
+		{"(a-b)-c", "a - b - c"},
+		{"a-(b+c)", "a - (b + c)"},
+		{"a/(b*c)", "a / (b * c)"},
+		{"a*b+c/d", "a*b + c/d"},
+		{"0xFF&077|0x0f", "0xFF&077 | 0x0f"},
+		{"2**(3**2)", "2 ** 3 ** 2"},
+		{"(2**3)**2", "(2 ** 3) ** 2"},
+		{"(-x)**2", "(-x) ** 2"},
+		{"-(x**2)", "-x ** 2"},
+		{"2**(-1)", "2 ** -1"},
+		{"-(a+b)", "-(a + b)"},
+		{"- -a", "--a"},
+		{"a*-b", "a * -b"},
+		{"a+b==c&&d", "a+b == c && d"},
+		{"a||(b&&c)", "a || b && c"},
+		{"(a||b)&&c", "(a || b) && c"},
+		{"max( a ,b,(c) )", "max(a, b, c)"},
+		{"if(a>0,a,-a)", "if(a > 0, a, -a)"},
+		{"(a?b:c)?d:(e?f:g)", "(a ? b : c) ? d : e ? f : g"},
+		{"(a?b:c)+1", "(a ? b : c) + 1"},
+		{"1.50*x", "1.50 * x"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Format(c.formula)
+		OK(t, err)
+		EQUALS(t, "formula should be formatted: "+c.formula, c.expected, actual)
+	}
+}
+
+func TestExpressionStringIsCanonicalForm(t *testing.T) {
+	e, err := calcrat.Compile("( price*quantity )-discount")
+	OK(t, err)
+	EQUALS(t, "expression should be printed in canonical form", "price*quantity - discount", e.String())
+}
+
+func TestFormatKeepsValue(t *testing.T) {
+	g := &formulaGen{
+		r:      rand.New(rand.NewSource(1)),
+		leaves: []string{"a", "b", "c", "0x0", "0x7", "0xf", "0", "1", "2", "3", "4"},
+		prefix: []string{"-", "+", "^", "~", "!"},
+		binary: []string{"+", "-", "*", "/", "%", "//", "**", "<<", ">>", "&", "|", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||"},
+		funcs:  []genFunc{{"max", 2}},
+		cond:   true,
+		tight:  true,
+	}
+	vars := calcrat.Variables{
+		"a": big.NewRat(3, 1),
+		"b": big.NewRat(-2, 1),
+		"c": big.NewRat(1, 2),
+	}
+
+	for i := 0; i < 5000; i++ {
+		formula := g.gen(5)
+		if _, err := calcrat.Parse(formula); err != nil {
+			continue
+		}
+
+		formatted, err := calcrat.Format(formula)
+		OK(t, err)
+		again, err := calcrat.Format(formatted)
+		OK(t, err)
+		EQUALS(t, "format should be idempotent: "+formula, formatted, again)
+
+		expected, expectedErr := calcrat.Calc(formula, vars, nil)
+		actual, err := calcrat.Calc(formatted, vars, nil)
+		EQUALS(t, "format should keep error: "+formula+" => "+formatted, expectedErr == nil, err == nil)
+		if err == nil {
+			EQUALS(t, "format should keep value: "+formula+" => "+formatted, expected.RatString(), actual.RatString())
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package calcrat
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Function is a function which can be called from formulas.
+// Arity is the number of arguments. If Variadic is true, Arity is the minimum number of arguments.
+// Call must not modify args.
+type Function struct {
+	Arity    int
+	Variadic bool
+	Call     func(args []*big.Rat) (*big.Rat, error)
+}
+
+// Functions is the registry of functions by name
+type Functions map[string]Function
+
+// builtin is a function known to the evaluation.
+// max is the maximum number of arguments of a variadic function, or 0 if it is unbounded.
+// scoped is called instead of Call if it is set, so that the function can respect the options of the evaluation.
+type builtin struct {
+	Function
+	max    int
+	scoped func(s *scope, args []*big.Rat) (*big.Rat, error)
+}
+
+// builtins holds the standard functions which are available in any formula
+var builtins = map[string]builtin{
+	"min":   {Function: Function{1, true, ratMin}},
+	"max":   {Function: Function{1, true, ratMax}},
+	"abs":   {Function: Function{1, false, ratAbs}},
+	"floor": {Function: Function{1, false, ratFloor}},
+	"ceil":  {Function: Function{1, false, ratCeil}},
+	"round": {Function: Function{1, true, ratRound}, max: 2, scoped: scopedRound},
+}
+
+// lookup returns the function of given name from functions or builtins
+func (s *scope) lookup(name string) (builtin, bool) {
+	if f, ok := s.functions[name]; ok {
+		return builtin{Function: f}, true
+	}
+	f, ok := builtins[name]
+	return f, ok
+}
+
+// arityError returns the error if f does not accept n arguments
+func (f builtin) arityError(name string, n int) error {
+	switch {
+	case f.max > 0 && n > f.max:
+		return &ArityError{Name: name, Arity: f.max, Args: n}
+	case n < f.Arity || (!f.Variadic && n > f.Arity):
+		return &ArityError{Name: name, Arity: f.Arity, Variadic: f.Variadic, Args: n}
+	}
+	return nil
+}
+
+// call represents a function call
+type call struct {
+	name   string
+	pos    int
+	args   []node
+	rparen int
+}
+
+func (c *call) val(s *scope) (*big.Rat, error) {
+	f, ok := s.lookup(c.name)
+	if !ok {
+		return nil, &UnknownFunctionError{Name: c.name}
+	}
+	if err := f.arityError(c.name, len(c.args)); err != nil {
+		return nil, err
+	}
+
+	args := make([]*big.Rat, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.val(s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	if err := s.canceled(); err != nil {
+		return nil, err
+	}
+	var v *big.Rat
+	var err error
+	if f.scoped != nil {
+		v, err = f.scoped(s, args)
+	} else {
+		v, err = f.Call(args)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not call function %s: %w", c.name, err)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("could not call function %s: function returned nil", c.name)
+	}
+	return v, nil
+}
+
+func (c *call) bounds() (int, int) {
+	return c.pos, c.rparen + 1
+}
+
+func ratMin(args []*big.Rat) (*big.Rat, error) {
+	v := args[0]
+	for _, arg := range args[1:] {
+		if arg.Cmp(v) < 0 {
+			v = arg
+		}
+	}
+	return new(big.Rat).Set(v), nil
+}
+
+func ratMax(args []*big.Rat) (*big.Rat, error) {
+	v := args[0]
+	for _, arg := range args[1:] {
+		if arg.Cmp(v) > 0 {
+			v = arg
+		}
+	}
+	return new(big.Rat).Set(v), nil
+}
+
+func ratAbs(args []*big.Rat) (*big.Rat, error) {
+	return new(big.Rat).Abs(args[0]), nil
+}
+
+// floorInt returns the greatest integer less than or equal to r
+func floorInt(r *big.Rat) *big.Int {
+	// Div rounds toward negative infinity since denominator is always positive
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+func ratFloor(args []*big.Rat) (*big.Rat, error) {
+	return new(big.Rat).SetInt(floorInt(args[0])), nil
+}
+
+func ratCeil(args []*big.Rat) (*big.Rat, error) {
+	i := floorInt(new(big.Rat).Neg(args[0]))
+	return new(big.Rat).SetInt(i.Neg(i)), nil
+}
+
+// ratRound rounds half away from zero.
+// The optional second argument is the number of decimal places, which can be negative.
+func ratRound(args []*big.Rat) (*big.Rat, error) {
+	return roundBits(args, DefaultMaxPowerBits)
+}
+
+// scopedRound rounds like ratRound, but bounds the scale like powers of the evaluation
+func scopedRound(s *scope, args []*big.Rat) (*big.Rat, error) {
+	return roundBits(args, s.maxPowerBits)
+}
+
+// roundBits rounds like ratRound. ErrPowerTooLarge is returned if the bit length of the scale exceeds maxBits.
+func roundBits(args []*big.Rat, maxBits int) (*big.Rat, error) {
+	scale := big.NewRat(1, 1)
+	if len(args) == 2 {
+		if !args[1].IsInt() || !args[1].Num().IsInt64() {
+			return nil, fmt.Errorf("decimal places must be an integer - %s", args[1].RatString())
+		}
+		digits := args[1].Num().Int64()
+		// 10**n has more than 3n bits. digits is compared before abs64, which overflows for math.MinInt64.
+		if max := int64(maxBits / 3); digits > max || digits < -max {
+			return nil, fmt.Errorf("%w - 10 ** %d", ErrPowerTooLarge, digits)
+		}
+		p := new(big.Int).Exp(big.NewInt(10), big.NewInt(abs64(digits)), nil)
+		if digits < 0 {
+			scale.SetFrac(big.NewInt(1), p)
+		} else {
+			scale.SetInt(p)
+		}
+	}
+
+	v := new(big.Rat).Mul(args[0], scale)
+	neg := v.Sign() < 0
+	v.Abs(v)
+	v.Add(v, big.NewRat(1, 2))
+	v.SetInt(floorInt(v))
+	if neg {
+		v.Neg(v)
+	}
+	return v.Quo(v, scale), nil
+}
+
+func abs64(i int64) int64 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
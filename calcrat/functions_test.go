@@ -0,0 +1,122 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestBuiltinFunctions(t *testing.T) {
+	vars := calcrat.Variables{
+		"a": big.NewRat(3, 1),
+		"b": big.NewRat(-7, 2),
+		"c": big.NewRat(5, 2),
+	}
+
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"max(a, b, c)", "3"},
+		{"min(a, b, c)", "-7/2"},
+		{"max(a)", "3"},
+		{"abs(b)", "7/2"},
+		{"floor(b)", "-4"},
+		{"floor(c)", "2"},
+		{"ceil(b)", "-3"},
+		{"ceil(c)", "3"},
+		{"ceil(a)", "3"},
+		{"round(c)", "3"},
+		{"round(b)", "-4"},
+		{"round(1/3, 2)", "33/100"},
+		{"round(2/3, 2)", "67/100"},
+		{"round(1250, -2)", "1300"},
+		{"1 + max(a*2, (c+1)) * -abs(b)", "-20"},
+		{"max(min(a, c), floor(b))", "5/2"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Calc(c.formula, vars, nil)
+		OK(t, err)
+		EQUALS(t, "builtin function should be evaluated: "+c.formula, c.expected, actual.RatString())
+	}
+}
+
+func TestUserFunctions(t *testing.T) {
+	fns := calcrat.Functions{
+		"tier": {Arity: 1, Call: func(args []*big.Rat) (*big.Rat, error) {
+			if args[0].Cmp(big.NewRat(1000, 1)) >= 0 {
+				return big.NewRat(2, 1), nil
+			}
+			return big.NewRat(1, 1), nil
+		}},
+		"answer": {Arity: 0, Call: func(args []*big.Rat) (*big.Rat, error) {
+			return big.NewRat(42, 1), nil
+		}},
+		"abs": {Arity: 1, Call: func(args []*big.Rat) (*big.Rat, error) {
+			return nil, errors.New("overridden")
+		}},
+	}
+	vars := calcrat.Variables{"amount": big.NewRat(1500, 1)}
+
+	actual, err := calcrat.CalcFunctions("tier(amount) * 10 + answer()", vars, fns, nil)
+	OK(t, err)
+	EQUALS(t, "user function should be evaluated", "62", actual.RatString())
+
+	_, err = calcrat.CalcFunctions("abs(amount)", vars, fns, nil)
+	ASSERT(t, "user function should override builtin", err != nil)
+
+	fns["round"] = calcrat.Function{Arity: 3, Call: func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Add(args[0], args[2]), nil
+	}}
+	actual, err = calcrat.CalcFunctions("round(1, 100000, 2)", vars, fns, nil)
+	OK(t, err)
+	EQUALS(t, "user function should override builtin of any arity", "3", actual.RatString())
+
+	fns["none"] = calcrat.Function{Arity: 0, Call: func(args []*big.Rat) (*big.Rat, error) {
+		return nil, nil
+	}}
+	_, err = calcrat.CalcFunctions("none() + 1", vars, fns, nil)
+	ASSERT(t, "nil result should be rejected", err != nil)
+}
+
+func TestFunctionErrors(t *testing.T) {
+	var err error
+	var ue *calcrat.UnknownFunctionError
+	var ae *calcrat.ArityError
+	var se *calcrat.SyntaxError
+
+	_, err = calcrat.Calc("unknown(1)", nil, nil)
+	ASSERT(t, "error should be UnknownFunctionError", errors.As(err, &ue))
+	EQUALS(t, "name should match", "unknown", ue.Name)
+
+	_, err = calcrat.Calc("abs(1, 2)", nil, nil)
+	ASSERT(t, "error should be ArityError", errors.As(err, &ae))
+	EQUALS(t, "args should match", 2, ae.Args)
+
+	_, err = calcrat.Calc("max()", nil, nil)
+	ASSERT(t, "error should be ArityError", errors.As(err, &ae))
+
+	_, err = calcrat.Calc("round(1, 2, 3)", nil, nil)
+	ASSERT(t, "error should be ArityError", errors.As(err, &ae))
+	EQUALS(t, "name should match", "round", ae.Name)
+	EQUALS(t, "arity should match", 2, ae.Arity)
+	ASSERT(t, "arity should be exact", !ae.Variadic)
+
+	_, err = calcrat.Calc("round(1, 1/2)", nil, nil)
+	ASSERT(t, "error should not be nil", err != nil)
+
+	_, err = calcrat.Calc("max(1, 2", nil, nil)
+	ASSERT(t, "error should be SyntaxError", errors.As(err, &se))
+	EQUALS(t, "expected should match", ", or )", se.Expected)
+
+	_, err = calcrat.Calc("max(1,,2)", nil, nil)
+	ASSERT(t, "error should be SyntaxError", errors.As(err, &se))
+	EQUALS(t, "offset should match", 6, se.Offset)
+
+	_, err = calcrat.Calc("1, 2", nil, nil)
+	ASSERT(t, "error should be SyntaxError", errors.As(err, &se))
+}
@@ -1,5 +1,18 @@
 package calcrat
 
-import "math/big"
+import (
+	"context"
+	"math/big"
+)
 
 type Handler func(string) *big.Rat
+
+// Resolve returns the value which h returns for given name. nil from h means the name is unknown.
+func (h Handler) Resolve(ctx context.Context, name string) (*big.Rat, error) {
+	if h != nil {
+		if v := h(name); v != nil {
+			return v, nil
+		}
+	}
+	return nil, &UnknownIdentifierError{Name: name}
+}
@@ -0,0 +1,64 @@
+package calcrat_test
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// formulaGen generates random formulas for the tests which compare results of different evaluations.
+// Operators are separated by spaces, so that formulas can also be parsed as Go expressions,
+// unless tight is set to write them without spaces as in -x, a-b, !x and x*15%.
+type formulaGen struct {
+	r      *rand.Rand
+	leaves []string
+	prefix []string
+	binary []string
+	// funcs holds the names of functions and their number of arguments
+	funcs  []genFunc
+	cond   bool
+	powers bool
+	tight  bool
+}
+
+type genFunc struct {
+	name  string
+	arity int
+}
+
+// gen returns a formula whose nesting is at most depth
+func (g *formulaGen) gen(depth int) string {
+	if depth == 0 || g.r.Intn(5) == 0 {
+		return g.leaves[g.r.Intn(len(g.leaves))]
+	}
+	sp := " "
+	if g.tight {
+		sp = ""
+	}
+	switch g.r.Intn(8) {
+	case 0:
+		if len(g.prefix) > 0 {
+			return g.prefix[g.r.Intn(len(g.prefix))] + sp + g.gen(depth-1)
+		}
+	case 1:
+		return "(" + g.gen(depth-1) + ")"
+	case 2:
+		if g.cond {
+			return g.gen(depth-1) + sp + "?" + sp + g.gen(depth-1) + sp + ":" + sp + g.gen(depth-1)
+		}
+	case 3:
+		if len(g.funcs) > 0 {
+			f := g.funcs[g.r.Intn(len(g.funcs))]
+			args := make([]string, f.arity)
+			for i := range args {
+				args[i] = g.gen(depth - 1)
+			}
+			return f.name + "(" + strings.Join(args, ","+sp) + ")"
+		}
+	case 4:
+		if g.powers {
+			return "(" + g.gen(depth-1) + ")" + sp + "**" + sp + strconv.Itoa(g.r.Intn(4))
+		}
+	}
+	return g.gen(depth-1) + sp + g.binary[g.r.Intn(len(g.binary))] + sp + g.gen(depth-1)
+}
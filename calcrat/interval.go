@@ -0,0 +1,439 @@
+package calcrat
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Interval is the closed range of rationals from Lo to Hi
+type Interval struct {
+	Lo, Hi *big.Rat
+}
+
+// Point returns the interval which contains only v
+func Point(v *big.Rat) Interval {
+	return Interval{new(big.Rat).Set(v), new(big.Rat).Set(v)}
+}
+
+// IsPoint reports whether the interval contains only one value
+func (x Interval) IsPoint() bool {
+	return x.Lo.Cmp(x.Hi) == 0
+}
+
+// Contains reports whether v is in the interval
+func (x Interval) Contains(v *big.Rat) bool {
+	return x.Lo.Cmp(v) <= 0 && v.Cmp(x.Hi) <= 0
+}
+
+func (x Interval) String() string {
+	if x.Lo == nil || x.Hi == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("[%s, %s]", x.Lo.RatString(), x.Hi.RatString())
+}
+
+// Intervals is a set of named intervals
+type Intervals map[string]Interval
+
+// Intervals returns the variables as point intervals, so that they can be mixed with intervals.
+// nil variables are left as invalid intervals, which EvalInterval rejects.
+func (v Variables) Intervals() Intervals {
+	n := make(Intervals, len(v))
+	for name, r := range v {
+		if r == nil {
+			n[name] = Interval{}
+			continue
+		}
+		n[name] = Point(r)
+	}
+	return n
+}
+
+// CalcInterval returns the interval which encloses every value of given formula
+// where each variable takes any value in its interval.
+// See EvalInterval for the operators supported on intervals.
+func CalcInterval(formula string, variables Intervals) (Interval, error) {
+	e, err := Compile(formula)
+	if err != nil {
+		return Interval{}, err
+	}
+	return e.EvalInterval(variables)
+}
+
+// EvalInterval returns the interval which encloses every value of the expression
+// where each variable takes any value in its interval.
+// The bounds are exact for each operation, but may be wider than the exact range of the expression
+// when a variable appears more than once, e.g. x - x for x in [0, 1] is [-1, 1].
+// Division by an interval containing zero fails with DivisorContainsZeroError.
+// Comparisons and logical operators result in [0, 1] when their truth depends on the values,
+// and conditionals result in the union of both branches then.
+// Floor division and shifts, which accept only integers, are supported on intervals whose bounds are integers
+// and enclose the values for the integers in the intervals. Unlike the other operators,
+// % and bitwise operators are supported only on point intervals, since they are not monotone.
+// The limits of the expression are enforced like Eval, where MaxBits applies to both bounds.
+func (e *Expression) EvalInterval(variables Intervals) (Interval, error) {
+	for name, v := range variables {
+		if v.Lo == nil || v.Hi == nil || v.Lo.Cmp(v.Hi) > 0 {
+			return Interval{}, fmt.Errorf("invalid interval of %s - %v", name, v)
+		}
+	}
+	n := &intervalEval{
+		formula:   e.formula,
+		variables: variables,
+		rat:       RatDomain{maxPowerBits: e.maxPowerBits},
+		limits:    e.limits,
+	}
+	v, err := n.eval(e.ast)
+	if err != nil {
+		return Interval{}, err
+	}
+	return Interval{new(big.Rat).Set(v.Lo), new(big.Rat).Set(v.Hi)}, nil
+}
+
+type intervalEval struct {
+	formula   string
+	variables Intervals
+	// rat evaluates operators on points
+	rat    RatDomain
+	limits Limits
+	steps  int
+}
+
+func (n *intervalEval) text(x Node) string {
+	return n.formula[x.Pos():x.End()]
+}
+
+var (
+	intervalFalse   = Interval{new(big.Rat), new(big.Rat)}
+	intervalTrue    = Interval{big.NewRat(1, 1), big.NewRat(1, 1)}
+	intervalUnknown = Interval{new(big.Rat), big.NewRat(1, 1)}
+)
+
+// truthOf returns 1 if x is true for any value, 0 if false for any value and -1 otherwise
+func truthOf(x Interval) int {
+	switch {
+	case x.Lo.Sign() > 0 || x.Hi.Sign() < 0:
+		return 1
+	case x.Lo.Sign() == 0 && x.Hi.Sign() == 0:
+		return 0
+	}
+	return -1
+}
+
+// boolInterval returns the interval of truth t given by truthOf
+func boolInterval(t int) Interval {
+	switch t {
+	case 1:
+		return intervalTrue
+	case 0:
+		return intervalFalse
+	}
+	return intervalUnknown
+}
+
+// hull returns the smallest interval which contains all of xs
+func hull(xs ...Interval) Interval {
+	lo, hi := xs[0].Lo, xs[0].Hi
+	for _, x := range xs[1:] {
+		if x.Lo.Cmp(lo) < 0 {
+			lo = x.Lo
+		}
+		if x.Hi.Cmp(hi) > 0 {
+			hi = x.Hi
+		}
+	}
+	return Interval{lo, hi}
+}
+
+// span returns the smallest interval which contains all of vs
+func span(vs ...*big.Rat) Interval {
+	x := Interval{vs[0], vs[0]}
+	for _, v := range vs[1:] {
+		x = hull(x, Interval{v, v})
+	}
+	return x
+}
+
+// eval counts the evaluation of x as a step and checks the size of its bounds like the nodes of the tree walker
+func (n *intervalEval) eval(x Expr) (Interval, error) {
+	n.steps++
+	if max := n.limits.MaxSteps; max > 0 && n.steps > max {
+		return Interval{}, &LimitExceededError{Limit: "MaxSteps", Max: max}
+	}
+	v, err := n.evalExpr(x)
+	if err != nil {
+		return Interval{}, err
+	}
+	if max := n.limits.MaxBits; max > 0 && (Rat{v.Lo}.bitLen() > max || Rat{v.Hi}.bitLen() > max) {
+		return Interval{}, &LimitExceededError{Limit: "MaxBits", Max: max, Expr: n.text(x)}
+	}
+	return v, nil
+}
+
+func (n *intervalEval) evalExpr(x Expr) (Interval, error) {
+	switch x := x.(type) {
+	case *NumberLit:
+		v, ok := parseNumber(x.Value)
+		if !ok {
+			return Interval{}, &InvalidLiteralError{Formula: n.formula, Offset: x.Pos(), Literal: x.Value}
+		}
+		return Interval{v, v}, nil
+	case *Ident:
+		if v, ok := n.variables[x.Name]; ok {
+			return v, nil
+		}
+		return Interval{}, &UnknownIdentifierError{Name: x.Name}
+	case *Paren:
+		return n.eval(x.X)
+	case *UnaryExpr:
+		return n.evalUnary(x)
+	case *BinaryExpr:
+		return n.evalBinary(x)
+	case *Call:
+		if x.Fun.Name == "if" {
+			if len(x.Args) != 3 {
+				return Interval{}, &ArityError{Name: x.Fun.Name, Arity: 3, Args: len(x.Args)}
+			}
+			return n.evalCond(x.Args[0], x.Args[1], x.Args[2])
+		}
+		return n.evalCall(x)
+	case *CondExpr:
+		return n.evalCond(x.Cond, x.Then, x.Else)
+	}
+	_, err := build(n.formula, x, false)
+	return Interval{}, err
+}
+
+func (n *intervalEval) evalUnary(x *UnaryExpr) (Interval, error) {
+	v, err := n.eval(x.X)
+	if err != nil {
+		return Interval{}, err
+	}
+	switch x.Op {
+	case "+":
+		return v, nil
+	case "-":
+		return Interval{new(big.Rat).Neg(v.Hi), new(big.Rat).Neg(v.Lo)}, nil
+	case "!":
+		if t := truthOf(v); t >= 0 {
+			return boolInterval(1 - t), nil
+		}
+		return intervalUnknown, nil
+	}
+	if !v.IsPoint() {
+		return Interval{}, unsupported("interval", x.Op)
+	}
+	r, err := n.rat.Unary(x.Op, Rat{v.Lo})
+	if err != nil {
+		return Interval{}, err
+	}
+	return Point(r.(Rat).V), nil
+}
+
+func (n *intervalEval) evalBinary(x *BinaryExpr) (Interval, error) {
+	l, err := n.eval(x.X)
+	if err != nil {
+		return Interval{}, err
+	}
+	lt := truthOf(l)
+	if (x.Op == "&&" && lt == 0) || (x.Op == "||" && lt == 1) {
+		return boolInterval(lt), nil
+	}
+	r, err := n.eval(x.Y)
+	if err != nil {
+		return Interval{}, err
+	}
+
+	switch x.Op {
+	case "&&", "||":
+		rt := truthOf(r)
+		if (x.Op == "&&" && rt == 0) || (x.Op == "||" && rt == 1) || lt >= 0 {
+			return boolInterval(rt), nil
+		}
+		return intervalUnknown, nil
+	case "==", "!=":
+		t := -1
+		if l.IsPoint() && r.IsPoint() && l.Lo.Cmp(r.Lo) == 0 {
+			t = 1
+		} else if l.Hi.Cmp(r.Lo) < 0 || r.Hi.Cmp(l.Lo) < 0 {
+			t = 0
+		}
+		if x.Op == "!=" && t >= 0 {
+			t = 1 - t
+		}
+		return boolInterval(t), nil
+	case ">", ">=":
+		l, r = r, l
+		fallthrough
+	case "<", "<=":
+		strict := x.Op == "<" || x.Op == ">"
+		switch {
+		case l.Hi.Cmp(r.Lo) < 0 || (!strict && l.Hi.Cmp(r.Lo) == 0):
+			return intervalTrue, nil
+		case r.Hi.Cmp(l.Lo) < 0 || (strict && r.Hi.Cmp(l.Lo) == 0):
+			return intervalFalse, nil
+		}
+		return intervalUnknown, nil
+	case "+":
+		return Interval{new(big.Rat).Add(l.Lo, r.Lo), new(big.Rat).Add(l.Hi, r.Hi)}, nil
+	case "-":
+		return Interval{new(big.Rat).Sub(l.Lo, r.Hi), new(big.Rat).Sub(l.Hi, r.Lo)}, nil
+	case "*":
+		return mulInterval(l, r), nil
+	case "/", "//":
+		if r.Contains(new(big.Rat)) {
+			return Interval{}, &DivisorContainsZeroError{Expr: n.text(x.Y), Divisor: r}
+		}
+		if x.Op == "/" {
+			return mulInterval(l, Interval{new(big.Rat).Inv(r.Hi), new(big.Rat).Inv(r.Lo)}), nil
+		}
+		if isIntegral(l) && isIntegral(r) {
+			return n.corners(x.Op, l, r)
+		}
+	case "<<", ">>":
+		if isIntegral(l) && isIntegral(r) {
+			return n.corners(x.Op, l, r)
+		}
+	case "**":
+		return n.pow(x, l, r)
+	}
+
+	if !l.IsPoint() || !r.IsPoint() {
+		return Interval{}, unsupported("interval", x.Op)
+	}
+	v, err := n.rat.Binary(x.Op, Rat{l.Lo}, Rat{r.Lo})
+	if err != nil {
+		return Interval{}, err
+	}
+	return Point(v.(Rat).V), nil
+}
+
+// isIntegral reports whether both bounds of x are integers
+func isIntegral(x Interval) bool {
+	return x.Lo.IsInt() && x.Hi.IsInt()
+}
+
+// corners returns the interval of the results of op on the bounds of l and r,
+// which encloses the results on the intervals since op is monotone in each operand
+func (n *intervalEval) corners(op string, l, r Interval) (Interval, error) {
+	vs := make([]*big.Rat, 0, 4)
+	for _, a := range []*big.Rat{l.Lo, l.Hi} {
+		for _, b := range []*big.Rat{r.Lo, r.Hi} {
+			v, err := n.rat.Binary(op, Rat{a}, Rat{b})
+			if err != nil {
+				return Interval{}, err
+			}
+			vs = append(vs, v.(Rat).V)
+		}
+	}
+	return span(vs...), nil
+}
+
+func mulInterval(l, r Interval) Interval {
+	return span(
+		new(big.Rat).Mul(l.Lo, r.Lo),
+		new(big.Rat).Mul(l.Lo, r.Hi),
+		new(big.Rat).Mul(l.Hi, r.Lo),
+		new(big.Rat).Mul(l.Hi, r.Hi),
+	)
+}
+
+// pow returns the interval of l ** r. The exponent must be a single integer.
+func (n *intervalEval) pow(x *BinaryExpr, l, r Interval) (Interval, error) {
+	if !r.IsPoint() || !r.Lo.IsInt() {
+		return Interval{}, fmt.Errorf("%w - %s must be a single integer", ErrNonIntegerExponent, n.text(x.Y))
+	}
+	if r.Lo.Sign() < 0 && l.Contains(new(big.Rat)) {
+		return Interval{}, &DivisorContainsZeroError{Expr: n.text(x.X), Divisor: l}
+	}
+
+	bounds := make([]*big.Rat, 2)
+	for i, base := range []*big.Rat{l.Lo, l.Hi} {
+		v, err := n.rat.Binary("**", Rat{base}, Rat{r.Lo})
+		if err != nil {
+			return Interval{}, err
+		}
+		bounds[i] = v.(Rat).V
+	}
+	v := span(bounds...)
+	// x ** n of even n takes the minimum 0 at x = 0
+	if r.Lo.Num().Bit(0) == 0 && r.Lo.Sign() > 0 && l.Lo.Sign() < 0 && l.Hi.Sign() > 0 {
+		v.Lo = new(big.Rat)
+	}
+	return v, nil
+}
+
+func (n *intervalEval) evalCond(cond, then, els Expr) (Interval, error) {
+	c, err := n.eval(cond)
+	if err != nil {
+		return Interval{}, err
+	}
+	switch truthOf(c) {
+	case 1:
+		return n.eval(then)
+	case 0:
+		return n.eval(els)
+	}
+
+	t, err := n.eval(then)
+	if err != nil {
+		return Interval{}, err
+	}
+	e, err := n.eval(els)
+	if err != nil {
+		return Interval{}, err
+	}
+	return hull(t, e), nil
+}
+
+func (n *intervalEval) evalCall(x *Call) (Interval, error) {
+	args := make([]Interval, len(x.Args))
+	for i, arg := range x.Args {
+		v, err := n.eval(arg)
+		if err != nil {
+			return Interval{}, err
+		}
+		args[i] = v
+	}
+
+	f, ok := builtins[x.Fun.Name]
+	if !ok {
+		return Interval{}, &UnknownFunctionError{Name: x.Fun.Name}
+	}
+	if err := f.arityError(x.Fun.Name, len(args)); err != nil {
+		return Interval{}, err
+	}
+
+	switch x.Fun.Name {
+	case "abs":
+		v := args[0]
+		switch {
+		case v.Lo.Sign() >= 0:
+			return v, nil
+		case v.Hi.Sign() <= 0:
+			return Interval{new(big.Rat).Neg(v.Hi), new(big.Rat).Neg(v.Lo)}, nil
+		}
+		return span(new(big.Rat), new(big.Rat).Neg(v.Lo), v.Hi), nil
+	case "round":
+		if len(args) == 2 && !args[1].IsPoint() {
+			return Interval{}, fmt.Errorf("decimal places must be a single integer - %s", args[1])
+		}
+	}
+
+	// min, max, floor, ceil and round are monotone in each argument,
+	// so that the bounds are the results of the bounds
+	lo := make([]*big.Rat, len(args))
+	hi := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		lo[i], hi[i] = arg.Lo, arg.Hi
+	}
+	l, err := f.Call(lo)
+	if err != nil {
+		return Interval{}, fmt.Errorf("could not call function %s: %w", x.Fun.Name, err)
+	}
+	h, err := f.Call(hi)
+	if err != nil {
+		return Interval{}, fmt.Errorf("could not call function %s: %w", x.Fun.Name, err)
+	}
+	return Interval{new(big.Rat).Set(l), new(big.Rat).Set(h)}, nil
+}
@@ -0,0 +1,194 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func interval(lo, hi string) calcrat.Interval {
+	l, _ := new(big.Rat).SetString(lo)
+	h, _ := new(big.Rat).SetString(hi)
+	return calcrat.Interval{Lo: l, Hi: h}
+}
+
+func TestCalcIntervalBoundsResult(t *testing.T) {
+	vars := calcrat.Intervals{
+		"principal": calcrat.Point(big.NewRat(1000, 1)),
+		"rate":      interval("0.02", "0.05"),
+	}
+	actual, err := calcrat.CalcInterval("principal * (1 + rate) ** 2", vars)
+	OK(t, err)
+	EQUALS(t, "bounds should be exact", "[5202/5, 2205/2]", actual.String())
+}
+
+func TestCalcIntervalOperators(t *testing.T) {
+	vars := calcrat.Intervals{
+		"x": interval("-2", "3"),
+		"y": interval("1", "4"),
+		"z": interval("-3", "-1/2"),
+	}
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"x + y", "[-1, 7]"},
+		{"x - y", "[-6, 2]"},
+		{"x - x", "[-5, 5]"},
+		{"x * y", "[-8, 12]"},
+		{"x * z", "[-9, 6]"},
+		{"x / y", "[-2, 3]"},
+		{"y / z", "[-8, -1/3]"},
+		{"x // y", "[-2, 3]"},
+		{"y // -2", "[-2, -1]"},
+		{"y << 2", "[4, 16]"},
+		{"x << y", "[-32, 48]"},
+		{"x >> 1", "[-1, 1]"},
+		{"-x", "[-3, 2]"},
+		{"x ** 2", "[0, 9]"},
+		{"x ** 3", "[-8, 27]"},
+		{"z ** 2", "[1/4, 9]"},
+		{"y ** -1", "[1/4, 1]"},
+		{"abs(x)", "[0, 3]"},
+		{"abs(z)", "[1/2, 3]"},
+		{"min(x, y)", "[-2, 3]"},
+		{"max(x, z)", "[-2, 3]"},
+		{"floor(z)", "[-3, -1]"},
+		{"round(y / 3, 1)", "[3/10, 13/10]"},
+		{"z < y", "[1, 1]"},
+		{"x < y", "[0, 1]"},
+		{"y <= 1", "[0, 1]"},
+		{"y >= 1", "[1, 1]"},
+		{"z == y", "[0, 0]"},
+		{"z != y", "[1, 1]"},
+		{"!z", "[0, 0]"},
+		{"!x", "[0, 1]"},
+		{"z < 0 && x", "[0, 1]"},
+		{"z > 0 && 1 / x", "[0, 0]"},
+		{"x > 0 || y", "[1, 1]"},
+		{"x > 0 ? y : z", "[-3, 4]"},
+		{"if(z < 0, y, 1 / x)", "[1, 4]"},
+		{"7 % 4", "[3, 3]"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.CalcInterval(c.formula, vars)
+		OK(t, err)
+		EQUALS(t, "interval should be enclosed: "+c.formula, c.expected, actual.String())
+	}
+}
+
+func TestCalcIntervalReportsErrors(t *testing.T) {
+	vars := calcrat.Intervals{"x": interval("-1", "1"), "y": interval("1", "2")}
+
+	_, err := calcrat.CalcInterval("y / (x + 1/2)", vars)
+	var de *calcrat.DivisorContainsZeroError
+	ASSERT(t, "division by interval containing zero should fail", errors.As(err, &de))
+	ASSERT(t, "error should be division by zero", errors.Is(err, calcrat.ErrDivisionByZero))
+	EQUALS(t, "divisor should be reported", "(x + 1/2)", de.Expr)
+	EQUALS(t, "interval of divisor should be reported", "[-1/2, 3/2]", de.Divisor.String())
+
+	_, err = calcrat.CalcInterval("x > 0 ? 1 / x : 0", vars)
+	ASSERT(t, "branch which may be taken should be evaluated", errors.Is(err, calcrat.ErrDivisionByZero))
+
+	_, err = calcrat.CalcInterval("2 ** y", vars)
+	ASSERT(t, "exponent should be a single integer", errors.Is(err, calcrat.ErrNonIntegerExponent))
+
+	_, err = calcrat.CalcInterval("y % 2", vars)
+	ASSERT(t, "integer operators should be unsupported on ranges", errors.Is(err, calcrat.ErrUnsupportedOperation))
+
+	_, err = calcrat.CalcInterval("x // 1", calcrat.Intervals{"x": interval("1/2", "3/2")})
+	ASSERT(t, "integer division should be unsupported on ranges of non-integer bounds", errors.Is(err, calcrat.ErrUnsupportedOperation))
+
+	_, err = calcrat.CalcInterval("y << -1", vars)
+	ASSERT(t, "negative shift count should be rejected", err != nil)
+
+	_, err = calcrat.CalcInterval("x // 1", calcrat.Intervals{"x": calcrat.Point(big.NewRat(3, 2))})
+	ASSERT(t, "integer division should reject non-integer operands", errors.Is(err, calcrat.ErrNonIntegerOperand))
+
+	_, err = calcrat.CalcInterval("x + z", vars)
+	var ue *calcrat.UnknownIdentifierError
+	ASSERT(t, "unknown variable should fail", errors.As(err, &ue))
+
+	_, err = calcrat.CalcInterval("x", calcrat.Intervals{"x": interval("1", "0")})
+	ASSERT(t, "empty interval should be rejected", err != nil)
+
+	_, err = calcrat.CalcInterval("x + 1", calcrat.Variables{"x": nil}.Intervals())
+	ASSERT(t, "nil variable should be rejected", err != nil)
+}
+
+func TestEvalIntervalEnforcesLimits(t *testing.T) {
+	vars := calcrat.Intervals{"x": interval("1", "1073741824")}
+	e, err := calcrat.CompileLimits("x * x * x", calcrat.Limits{MaxBits: 64})
+	OK(t, err)
+	_, err = e.EvalInterval(vars)
+	EQUALS(t, "large bound should be rejected", "MaxBits", limitOf(err))
+	EQUALS(t, "expression should be reported", "limit exceeded - MaxBits 64 by x * x * x", err.Error())
+
+	v, err := e.EvalInterval(calcrat.Intervals{"x": interval("1", "2")})
+	OK(t, err)
+	EQUALS(t, "bounds within limits should be evaluated", "[1, 8]", v.String())
+
+	e, err = calcrat.CompileLimits("1+1+1+1+1+1+1+1+1+1+1", calcrat.Limits{MaxSteps: 20})
+	OK(t, err)
+	_, err = e.EvalInterval(nil)
+	EQUALS(t, "long evaluation should be rejected", "MaxSteps", limitOf(err))
+
+	e, err = calcrat.Compile("x ** 100")
+	OK(t, err)
+	_, err = e.WithMaxPowerBits(64).EvalInterval(calcrat.Intervals{"x": interval("1", "3")})
+	ASSERT(t, "power exceeding max power bits should be rejected", errors.Is(err, calcrat.ErrPowerTooLarge))
+}
+
+func TestCalcIntervalEnclosesValues(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	names := []string{"a", "b", "c"}
+	g := &formulaGen{
+		r:      r,
+		leaves: append([]string{"-2", "-1", "0", "1", "2"}, names...),
+		prefix: []string{"-"},
+		binary: []string{"+", "-", "*", "/", "<", "<=", "==", "!=", "&&", "||"},
+		funcs:  []genFunc{{"min", 2}, {"max", 2}, {"abs", 1}, {"floor", 1}, {"ceil", 1}, {"round", 1}},
+		cond:   true,
+		powers: true,
+		tight:  true,
+	}
+
+	evaluated := 0
+	for i := 0; i < 2000; i++ {
+		formula := g.gen(4)
+		vars := calcrat.Intervals{}
+		for _, name := range names {
+			lo := big.NewRat(int64(r.Intn(9)-4), int64(r.Intn(3)+1))
+			hi := new(big.Rat).Add(lo, big.NewRat(int64(r.Intn(7)), int64(r.Intn(3)+1)))
+			vars[name] = calcrat.Interval{Lo: lo, Hi: hi}
+		}
+		bounds, err := calcrat.CalcInterval(formula, vars)
+		if err != nil {
+			ASSERT(t, "only division by zero should fail: "+formula+": "+err.Error(), errors.Is(err, calcrat.ErrDivisionByZero))
+			continue
+		}
+		evaluated++
+
+		for j := 0; j < 10; j++ {
+			point := calcrat.Variables{}
+			for name, v := range vars {
+				w := new(big.Rat).Sub(v.Hi, v.Lo)
+				w.Mul(w, big.NewRat(int64(r.Intn(5)), 4))
+				point[name] = w.Add(w, v.Lo)
+			}
+			actual, err := calcrat.Calc(formula, point, nil)
+			OK(t, err)
+			ASSERT(t, "value should be enclosed: "+formula+" = "+actual.RatString()+" not in "+bounds.String(), bounds.Contains(actual))
+
+			exact, err := calcrat.CalcInterval(formula, point.Intervals())
+			OK(t, err)
+			ASSERT(t, "point intervals should be exact: "+formula, exact.IsPoint() && exact.Lo.Cmp(actual) == 0)
+		}
+	}
+	ASSERT(t, "most formulas should be evaluated", evaluated > 1000)
+}
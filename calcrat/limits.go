@@ -0,0 +1,71 @@
+package calcrat
+
+import "math/big"
+
+// Limits bounds the resources used to parse and evaluate a formula, so that untrusted formulas can be evaluated safely.
+// Zero means no limit. LimitExceededError is returned when a limit is exceeded.
+type Limits struct {
+	// MaxLength limits the length of the formula in bytes
+	MaxLength int
+	// MaxDepth limits the nesting depth of the AST
+	MaxDepth int
+	// MaxNodes limits the number of nodes of the AST
+	MaxNodes int
+	// MaxBits limits the bit length of numerator and denominator of literals, resolved values and intermediate results.
+	// Powers and shifts whose results obviously exceed the limit are rejected with ErrPowerTooLarge before computing.
+	MaxBits int
+	// MaxSteps limits the number of nodes evaluated in an evaluation
+	MaxSteps int
+}
+
+// check returns LimitExceededError if the AST exceeds MaxDepth or MaxNodes
+func (l Limits) check(x Expr) error {
+	if l.MaxDepth <= 0 && l.MaxNodes <= 0 {
+		return nil
+	}
+	nodes, depth, maxDepth := 0, 0, 0
+	Inspect(x, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		nodes++
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		return true
+	})
+	if l.MaxNodes > 0 && nodes > l.MaxNodes {
+		return &LimitExceededError{Limit: "MaxNodes", Max: l.MaxNodes}
+	}
+	if l.MaxDepth > 0 && maxDepth > l.MaxDepth {
+		return &LimitExceededError{Limit: "MaxDepth", Max: l.MaxDepth}
+	}
+	return nil
+}
+
+// evaluated reports whether the limits need to be enforced on evaluation
+func (l Limits) evaluated() bool {
+	return l.MaxBits > 0 || l.MaxSteps > 0
+}
+
+// limited counts the evaluation of n as a step and checks the size of its value
+type limited struct {
+	node
+}
+
+func (l *limited) val(s *scope) (*big.Rat, error) {
+	s.steps++
+	if max := s.limits.MaxSteps; max > 0 && s.steps > max {
+		return nil, &LimitExceededError{Limit: "MaxSteps", Max: max}
+	}
+	v, err := l.node.val(s)
+	if err != nil {
+		return nil, err
+	}
+	if max := s.limits.MaxBits; max > 0 && (v.Num().BitLen() > max || v.Denom().BitLen() > max) {
+		return nil, &LimitExceededError{Limit: "MaxBits", Max: max, Expr: s.text(l)}
+	}
+	return v, nil
+}
@@ -0,0 +1,94 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func limitOf(err error) string {
+	var le *calcrat.LimitExceededError
+	if !errors.As(err, &le) {
+		return ""
+	}
+	return le.Limit
+}
+
+func TestParseLimitsRejectsLargeFormulas(t *testing.T) {
+	tests := []struct {
+		formula string
+		limits  calcrat.Limits
+		limit   string
+	}{
+		{"1 + 2 + 3", calcrat.Limits{MaxLength: 8}, "MaxLength"},
+		{"((((1))))", calcrat.Limits{MaxDepth: 4}, "MaxDepth"},
+		{"-(-(-(-1)))", calcrat.Limits{MaxDepth: 4}, "MaxDepth"},
+		{"1+1+1+1+1", calcrat.Limits{MaxDepth: 4}, "MaxDepth"},
+		{"max(1, 2, 3, 4)", calcrat.Limits{MaxNodes: 4}, "MaxNodes"},
+		{strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000), calcrat.Limits{MaxDepth: 100}, "MaxDepth"},
+	}
+
+	for _, test := range tests {
+		_, err := calcrat.ParseLimits(test.formula, test.limits)
+		EQUALS(t, "limit should be exceeded: "+test.formula, test.limit, limitOf(err))
+	}
+
+	_, err := calcrat.ParseLimits("(1 + 2) * 3", calcrat.Limits{MaxLength: 11, MaxDepth: 4, MaxNodes: 6})
+	OK(t, err)
+}
+
+func TestParseLimitsRejectsDeepPowersEarly(t *testing.T) {
+	formula := strings.Repeat("x**", 100000) + "x"
+	var err error
+	allocs := testing.AllocsPerRun(1, func() {
+		_, err = calcrat.ParseLimits(formula, calcrat.Limits{MaxDepth: 100})
+	})
+	EQUALS(t, "limit should be exceeded", "MaxDepth", limitOf(err))
+	ASSERT(t, "deep powers should be rejected before the tree is built", allocs < 1000)
+}
+
+func TestCompileLimitsBoundsEvaluation(t *testing.T) {
+	limits := calcrat.Limits{MaxBits: 64, MaxSteps: 20}
+	e, err := calcrat.CompileLimits("x * x * x", limits)
+	OK(t, err)
+
+	v, err := e.Eval(calcrat.Variables{"x": big.NewRat(1<<20, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "value within limits should be evaluated", "1152921504606846976", v.RatString())
+
+	_, err = e.Eval(calcrat.Variables{"x": big.NewRat(1<<30, 1)}, nil)
+	EQUALS(t, "large intermediate result should be rejected", "MaxBits", limitOf(err))
+	EQUALS(t, "expression should be reported", "limit exceeded - MaxBits 64 by x * x * x", err.Error())
+
+	big70 := new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 70))
+	_, err = e.Eval(calcrat.Variables{"x": big70}, nil)
+	EQUALS(t, "large variable should be rejected", "MaxBits", limitOf(err))
+
+	e, err = calcrat.CompileLimits("x**100", limits)
+	OK(t, err)
+	_, err = e.Eval(calcrat.Variables{"x": big.NewRat(3, 1)}, nil)
+	ASSERT(t, "large power should be rejected before computing", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	e, err = calcrat.CompileLimits("round(x, 100000000)", limits)
+	OK(t, err)
+	_, err = e.Eval(calcrat.Variables{"x": big.NewRat(1, 3)}, nil)
+	ASSERT(t, "large decimal places should be rejected before computing", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	_, err = calcrat.Calc("round(1/3, -9223372036854775808)", nil, nil)
+	ASSERT(t, "smallest decimal places should be rejected", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	e, err = calcrat.CompileLimits("1+1+1+1+1+1+1+1+1+1+1", limits)
+	OK(t, err)
+	_, err = e.Eval(nil, nil)
+	EQUALS(t, "long evaluation should be rejected", "MaxSteps", limitOf(err))
+
+	e, err = calcrat.CompileLimits("if(x, 1, 1+1+1+1+1+1+1+1+1+1+1)", limits)
+	OK(t, err)
+	v, err = e.Eval(calcrat.Variables{"x": big.NewRat(1, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "branch not taken should not be counted", "1", v.RatString())
+}
@@ -0,0 +1,142 @@
+package calcrat
+
+import "math/big"
+
+// truth returns 1 for true and 0 for false
+func truth(b bool) *big.Rat {
+	if b {
+		return big.NewRat(1, 1)
+	}
+	return new(big.Rat)
+}
+
+// comparison represents comparison operators which result in 1 or 0.
+// test receives the result of comparing left operand with right operand.
+type comparison struct {
+	*opBase
+	test func(c int) bool
+}
+
+func newEqual() operator {
+	return &comparison{&opBase{}, func(c int) bool { return c == 0 }}
+}
+
+func newNotEqual() operator {
+	return &comparison{&opBase{}, func(c int) bool { return c != 0 }}
+}
+
+func newLess() operator {
+	return &comparison{&opBase{}, func(c int) bool { return c < 0 }}
+}
+
+func newLessEqual() operator {
+	return &comparison{&opBase{}, func(c int) bool { return c <= 0 }}
+}
+
+func newGreater() operator {
+	return &comparison{&opBase{}, func(c int) bool { return c > 0 }}
+}
+
+func newGreaterEqual() operator {
+	return &comparison{&opBase{}, func(c int) bool { return c >= 0 }}
+}
+
+func (op *comparison) val(s *scope) (*big.Rat, error) {
+	left, right, err := op.operandVals(s)
+	if err != nil {
+		return nil, err
+	}
+	return truth(op.test(left.Cmp(right))), nil
+}
+
+// logicalAnd represents logical AND (&&) operator.
+// Right operand is evaluated only if left operand is non-zero.
+type logicalAnd struct {
+	*opBase
+}
+
+func newLogicalAnd() operator {
+	return &logicalAnd{&opBase{}}
+}
+
+func (op *logicalAnd) val(s *scope) (*big.Rat, error) {
+	left, err := op.left.val(s)
+	if err != nil {
+		return nil, err
+	}
+	if left.Sign() == 0 {
+		return truth(false), nil
+	}
+	right, err := op.right.val(s)
+	if err != nil {
+		return nil, err
+	}
+	return truth(right.Sign() != 0), nil
+}
+
+// logicalOr represents logical OR (||) operator.
+// Right operand is evaluated only if left operand is zero.
+type logicalOr struct {
+	*opBase
+}
+
+func newLogicalOr() operator {
+	return &logicalOr{&opBase{}}
+}
+
+func (op *logicalOr) val(s *scope) (*big.Rat, error) {
+	left, err := op.left.val(s)
+	if err != nil {
+		return nil, err
+	}
+	if left.Sign() != 0 {
+		return truth(true), nil
+	}
+	right, err := op.right.val(s)
+	if err != nil {
+		return nil, err
+	}
+	return truth(right.Sign() != 0), nil
+}
+
+// logicalNot represents logical NOT (!) operator.
+type logicalNot struct {
+	*opBase
+}
+
+func newLogicalNot() operator {
+	return &logicalNot{&opBase{}}
+}
+
+func (op *logicalNot) val(s *scope) (*big.Rat, error) {
+	v, err := op.right.val(s)
+	if err != nil {
+		return nil, err
+	}
+	return truth(v.Sign() == 0), nil
+}
+
+// conditional represents cond ? then : else and if(cond, then, else).
+// Only the taken branch is evaluated.
+type conditional struct {
+	cond node
+	then node
+	els  node
+	pos  int
+	end  int
+}
+
+func (c *conditional) val(s *scope) (*big.Rat, error) {
+	v, err := c.cond.val(s)
+	if err != nil {
+		return nil, err
+	}
+	if v.Sign() != 0 {
+		return c.then.val(s)
+	}
+	return c.els.val(s)
+}
+
+func (c *conditional) bounds() (int, int) {
+	return c.pos, c.end
+}
@@ -0,0 +1,103 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	vars := calcrat.Variables{
+		"a": big.NewRat(3, 1),
+		"b": big.NewRat(7, 2),
+	}
+
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"a < b", "1"},
+		{"a <= b", "1"},
+		{"a > b", "0"},
+		{"a >= a", "1"},
+		{"a == 6/2", "1"},
+		{"a != 6/2", "0"},
+		{"a < b && b < 4", "1"},
+		{"a > b || b > 4", "0"},
+		{"a > b || b < 4", "1"},
+		{"!a", "0"},
+		{"!(a > b)", "1"},
+		{"1 + 2 == 3", "1"},
+		{"1 < 2 == 1", "1"},
+		{"0 || 1 && 0", "0"},
+		{"(a < b) * 10", "10"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Calc(c.formula, vars, nil)
+		OK(t, err)
+		EQUALS(t, "logical formula should be evaluated: "+c.formula, c.expected, actual.RatString())
+	}
+}
+
+func TestConditionalExpression(t *testing.T) {
+	formula := "amount >= 1000 && region == 3 ? amount*0.9 : amount"
+
+	actual, err := calcrat.Calc(formula, calcrat.Variables{"amount": big.NewRat(2000, 1), "region": big.NewRat(3, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "then branch should be taken", "1800", actual.RatString())
+
+	actual, err = calcrat.Calc(formula, calcrat.Variables{"amount": big.NewRat(2000, 1), "region": big.NewRat(2, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "else branch should be taken", "2000", actual.RatString())
+
+	actual, err = calcrat.Calc("a < 0 ? -1 : a == 0 ? 0 : 1", calcrat.Variables{"a": big.NewRat(0, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "conditional should be right associative", "0", actual.RatString())
+
+	actual, err = calcrat.Calc("if(a > 0, 10, 20) + 1", calcrat.Variables{"a": big.NewRat(1, 1)}, nil)
+	OK(t, err)
+	EQUALS(t, "if should be evaluated", "11", actual.RatString())
+}
+
+func TestUntakenBranchIsNotEvaluated(t *testing.T) {
+	vars := calcrat.Variables{"x": big.NewRat(0, 1)}
+
+	actual, err := calcrat.Calc("x != 0 ? 1/x : 0", vars, nil)
+	OK(t, err)
+	EQUALS(t, "guarded division should not be evaluated", "0", actual.RatString())
+
+	actual, err = calcrat.Calc("if(x == 0, 0, 1/x + unknown)", vars, nil)
+	OK(t, err)
+	EQUALS(t, "guarded branch should not be evaluated", "0", actual.RatString())
+
+	actual, err = calcrat.Calc("x != 0 && 1/x > 1", vars, nil)
+	OK(t, err)
+	EQUALS(t, "right operand of && should not be evaluated", "0", actual.RatString())
+
+	actual, err = calcrat.Calc("x == 0 || 1/x > 1", vars, nil)
+	OK(t, err)
+	EQUALS(t, "right operand of || should not be evaluated", "1", actual.RatString())
+
+	_, err = calcrat.Calc("x == 0 ? 1/x : 0", vars, nil)
+	ASSERT(t, "taken branch should be evaluated", errors.Is(err, calcrat.ErrDivisionByZero))
+}
+
+func TestConditionalErrors(t *testing.T) {
+	var se *calcrat.SyntaxError
+	var ae *calcrat.ArityError
+
+	_, err := calcrat.Calc("1 ? 2", nil, nil)
+	ASSERT(t, "error should be SyntaxError", errors.As(err, &se))
+	EQUALS(t, "expected should match", ":", se.Expected)
+
+	_, err = calcrat.Calc("1 = 2", nil, nil)
+	ASSERT(t, "error should be SyntaxError", errors.As(err, &se))
+	EQUALS(t, "token should match", "=", se.Token)
+
+	_, err = calcrat.Calc("if(1, 2)", nil, nil)
+	ASSERT(t, "error should be ArityError", errors.As(err, &ae))
+}
@@ -0,0 +1,6 @@
+//go:build !race
+
+package calcrat_test
+
+// raceEnabled reports whether the race detector is enabled, which makes sync.Pool drop items randomly
+const raceEnabled = false
@@ -0,0 +1,363 @@
+package calcrat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Number is a value of a Domain. Cmp is called only with a Number of the same Domain.
+type Number interface {
+	Sign() int
+	Cmp(y Number) int
+	String() string
+}
+
+// Numbers is a set of named numbers of a Domain
+type Numbers map[string]Number
+
+// Domain is a numeric backend which evaluates formulas with its own kind of Number.
+// The evaluator of formulas handles brackets, conditionals, logical and comparison operators,
+// min(), max() and abs() on behalf of Domain. Other operators and functions are delegated to Domain,
+// which returns an error wrapping ErrUnsupportedOperation for those it does not support.
+type Domain interface {
+	// Parse returns the number of a numeric literal
+	Parse(literal string) (Number, error)
+	// FromRat returns the number nearest to r
+	FromRat(r *big.Rat) (Number, error)
+	// Bool returns 1 for true and 0 for false
+	Bool(b bool) Number
+	Unary(op string, x Number) (Number, error)
+	Binary(op string, x, y Number) (Number, error)
+	Call(name string, args []Number) (Number, error)
+}
+
+// Numbers returns the variables converted to numbers of given domain
+func (v Variables) Numbers(d Domain) (Numbers, error) {
+	n := make(Numbers, len(v))
+	for name, r := range v {
+		if r == nil {
+			return nil, fmt.Errorf("could not convert %s: value is nil", name)
+		}
+		x, err := d.FromRat(r)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert %s: %w", name, err)
+		}
+		n[name] = x
+	}
+	return n, nil
+}
+
+// CalcNumber returns the value of given formula calculated in given domain with given variables
+func CalcNumber(formula string, d Domain, variables Numbers) (Number, error) {
+	e, err := Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvalNumber(d, variables)
+}
+
+// EvalNumber returns the value of the expression calculated in given domain with given variables.
+// The limits of the expression are enforced like Eval, where MaxBits applies to the numbers of RatDomain and IntDomain.
+// WithMaxPowerBits applies to RatDomain and IntDomain as well, while the other options such as WithDivisionByZero
+// are specific to the evaluation with big.Rat, so that they are not applied.
+func (e *Expression) EvalNumber(d Domain, variables Numbers) (Number, error) {
+	if b, ok := d.(powerBounded); ok {
+		d = b.withMaxPowerBits(e.maxPowerBits)
+	}
+	return (&numberEval{formula: e.formula, domain: d, variables: variables, limits: e.limits}).eval(e.ast)
+}
+
+// powerBounded is implemented by the domains which bound the bit length of powers like WithMaxPowerBits
+type powerBounded interface {
+	withMaxPowerBits(bits int) Domain
+}
+
+// sized is implemented by the numbers whose bit length is bounded by MaxBits of Limits
+type sized interface {
+	bitLen() int
+}
+
+type numberEval struct {
+	formula   string
+	domain    Domain
+	variables Numbers
+	limits    Limits
+	steps     int
+}
+
+func (n *numberEval) text(x Node) string {
+	return n.formula[x.Pos():x.End()]
+}
+
+// fill adds the part of the formula to the errors of domain which do not know the formula.
+// DivisionByZeroError gets the part of divisor, and other errors are wrapped with the part of x.
+func (n *numberEval) fill(err error, x, divisor Node) error {
+	var de *DivisionByZeroError
+	if errors.As(err, &de) {
+		de.Expr = n.text(divisor)
+		return err
+	}
+	return fmt.Errorf("could not evaluate %s: %w", n.text(x), err)
+}
+
+// eval counts the evaluation of x as a step and checks the size of its value like the nodes of the tree walker
+func (n *numberEval) eval(x Expr) (Number, error) {
+	n.steps++
+	if max := n.limits.MaxSteps; max > 0 && n.steps > max {
+		return nil, &LimitExceededError{Limit: "MaxSteps", Max: max}
+	}
+	v, err := n.evalExpr(x)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := v.(sized); ok && n.limits.MaxBits > 0 && b.bitLen() > n.limits.MaxBits {
+		return nil, &LimitExceededError{Limit: "MaxBits", Max: n.limits.MaxBits, Expr: n.text(x)}
+	}
+	return v, nil
+}
+
+func (n *numberEval) evalExpr(x Expr) (Number, error) {
+	switch x := x.(type) {
+	case *NumberLit:
+		return n.domain.Parse(x.Value)
+	case *Ident:
+		if v, ok := n.variables[x.Name]; ok {
+			return v, nil
+		}
+		return nil, &UnknownIdentifierError{Name: x.Name}
+	case *Paren:
+		return n.eval(x.X)
+	case *UnaryExpr:
+		v, err := n.eval(x.X)
+		if err != nil {
+			return nil, err
+		}
+		switch x.Op {
+		case "+":
+			return v, nil
+		case "!":
+			return n.domain.Bool(v.Sign() == 0), nil
+		}
+		r, err := n.domain.Unary(x.Op, v)
+		if err != nil {
+			return nil, n.fill(err, x, x)
+		}
+		return r, nil
+	case *BinaryExpr:
+		return n.evalBinary(x)
+	case *Call:
+		if x.Fun.Name == "if" {
+			if len(x.Args) != 3 {
+				return nil, &ArityError{Name: x.Fun.Name, Arity: 3, Args: len(x.Args)}
+			}
+			return n.evalCond(x.Args[0], x.Args[1], x.Args[2])
+		}
+		return n.evalCall(x)
+	case *CondExpr:
+		return n.evalCond(x.Cond, x.Then, x.Else)
+	}
+	_, err := build(n.formula, x, false)
+	return nil, err
+}
+
+func (n *numberEval) evalBinary(x *BinaryExpr) (Number, error) {
+	l, err := n.eval(x.X)
+	if err != nil {
+		return nil, err
+	}
+	if (x.Op == "&&" && l.Sign() == 0) || (x.Op == "||" && l.Sign() != 0) {
+		return n.domain.Bool(x.Op == "||"), nil
+	}
+	r, err := n.eval(x.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case "&&", "||":
+		return n.domain.Bool(r.Sign() != 0), nil
+	case "==":
+		return n.domain.Bool(l.Cmp(r) == 0), nil
+	case "!=":
+		return n.domain.Bool(l.Cmp(r) != 0), nil
+	case "<":
+		return n.domain.Bool(l.Cmp(r) < 0), nil
+	case "<=":
+		return n.domain.Bool(l.Cmp(r) <= 0), nil
+	case ">":
+		return n.domain.Bool(l.Cmp(r) > 0), nil
+	case ">=":
+		return n.domain.Bool(l.Cmp(r) >= 0), nil
+	}
+	v, err := n.domain.Binary(x.Op, l, r)
+	if err != nil {
+		return nil, n.fill(err, x, x.Y)
+	}
+	return v, nil
+}
+
+func (n *numberEval) evalCond(cond, then, els Expr) (Number, error) {
+	c, err := n.eval(cond)
+	if err != nil {
+		return nil, err
+	}
+	if c.Sign() != 0 {
+		return n.eval(then)
+	}
+	return n.eval(els)
+}
+
+func (n *numberEval) evalCall(x *Call) (Number, error) {
+	args := make([]Number, len(x.Args))
+	for i, arg := range x.Args {
+		v, err := n.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch x.Fun.Name {
+	case "min", "max":
+		if len(args) == 0 {
+			return nil, &ArityError{Name: x.Fun.Name, Arity: 1, Variadic: true}
+		}
+		v := args[0]
+		for _, arg := range args[1:] {
+			if c := arg.Cmp(v); (c < 0) == (x.Fun.Name == "min") && c != 0 {
+				v = arg
+			}
+		}
+		return v, nil
+	case "abs":
+		if len(args) != 1 {
+			return nil, &ArityError{Name: x.Fun.Name, Arity: 1, Args: len(args)}
+		}
+		if args[0].Sign() < 0 {
+			return n.domain.Unary("-", args[0])
+		}
+		return args[0], nil
+	}
+
+	v, err := n.domain.Call(x.Fun.Name, args)
+	if err != nil {
+		return nil, n.fill(err, x, x)
+	}
+	return v, nil
+}
+
+// unsupported returns the error for an operator or a function which domain does not support
+func unsupported(domain, op string) error {
+	return fmt.Errorf("%w - %s in %s", ErrUnsupportedOperation, op, domain)
+}
+
+// Rat is a Number of RatDomain
+type Rat struct {
+	V *big.Rat
+}
+
+func (x Rat) Sign() int        { return x.V.Sign() }
+func (x Rat) Cmp(y Number) int { return x.V.Cmp(y.(Rat).V) }
+func (x Rat) String() string   { return x.V.RatString() }
+
+func (x Rat) bitLen() int {
+	n, d := x.V.Num().BitLen(), x.V.Denom().BitLen()
+	if n > d {
+		return n
+	}
+	return d
+}
+
+// RatDomain evaluates formulas exactly with big.Rat like Calc.
+// Operators and functions are the same as the ones of Calc with the default options.
+type RatDomain struct {
+	// maxPowerBits is set by EvalNumber from the expression, or DefaultMaxPowerBits is used if it is zero
+	maxPowerBits int
+}
+
+func (d RatDomain) withMaxPowerBits(bits int) Domain {
+	d.maxPowerBits = bits
+	return d
+}
+
+func (d RatDomain) bits() int {
+	if d.maxPowerBits > 0 {
+		return d.maxPowerBits
+	}
+	return DefaultMaxPowerBits
+}
+
+func (RatDomain) Parse(literal string) (Number, error) {
+	v, ok := parseNumber(literal)
+	if !ok {
+		return nil, fmt.Errorf("invalid literal %s", literal)
+	}
+	return Rat{v}, nil
+}
+
+func (RatDomain) FromRat(r *big.Rat) (Number, error) {
+	return Rat{new(big.Rat).Set(r)}, nil
+}
+
+func (RatDomain) Bool(b bool) Number {
+	return Rat{truth(b)}
+}
+
+func (d RatDomain) Unary(op string, x Number) (Number, error) {
+	fn, ok := prefixOps[op]
+	if !ok {
+		return nil, unsupported("RatDomain", op)
+	}
+	operands, formula := ratLiterals(op, []Number{x}, "", "")
+	o := fn()
+	o.setRight(operands[0])
+	return ratVal(o, formula, d.bits())
+}
+
+func (d RatDomain) Binary(op string, x, y Number) (Number, error) {
+	b, ok := binaryOps[op]
+	if !ok {
+		return nil, unsupported("RatDomain", op)
+	}
+	operands, formula := ratLiterals("", []Number{x, y}, " "+op+" ", "")
+	o := b.new()
+	o.setLeft(operands[0])
+	o.setRight(operands[1])
+	return ratVal(o, formula, d.bits())
+}
+
+func (d RatDomain) Call(name string, args []Number) (Number, error) {
+	operands, formula := ratLiterals(name+"(", args, ", ", ")")
+	return ratVal(&call{name: name, args: operands, rparen: len(formula) - 1}, formula, d.bits())
+}
+
+// ratLiterals returns the literals of xs and the formula in which they are written between prefix and suffix
+// separated by sep, so that errors of the tree walker describe the operands
+func ratLiterals(prefix string, xs []Number, sep, suffix string) ([]node, string) {
+	nodes := make([]node, len(xs))
+	var b strings.Builder
+	b.WriteString(prefix)
+	for i, x := range xs {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		v := x.(Rat).V
+		pos := b.Len()
+		b.WriteString(v.RatString())
+		nodes[i] = &literal{v: v, pos: pos, end: b.Len()}
+	}
+	b.WriteString(suffix)
+	return nodes, b.String()
+}
+
+// ratVal evaluates n of the tree walker whose operands are literals in formula
+func ratVal(n node, formula string, maxPowerBits int) (Number, error) {
+	v, err := n.val(&scope{formula: formula, ctx: context.Background(), resolver: Variables{}, maxPowerBits: maxPowerBits})
+	if err != nil {
+		return nil, err
+	}
+	return Rat{new(big.Rat).Set(v)}, nil
+}
@@ -0,0 +1,286 @@
+package calcrat
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Float64 is a Number of Float64Domain
+type Float64 float64
+
+func (x Float64) Sign() int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+func (x Float64) Cmp(y Number) int {
+	return (x - y.(Float64)).Sign()
+}
+
+func (x Float64) String() string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 64)
+}
+
+// Float64Domain evaluates formulas fast with float64 following IEEE 754, so that division by zero results in infinity.
+// Results of NaN are reported as ErrNaN. Integer operators such as << and & are not supported.
+// sqrt(), log(), exp(), floor(), ceil() and round() are available in addition to min(), max() and abs().
+type Float64Domain struct{}
+
+func (Float64Domain) Parse(literal string) (Number, error) {
+	v, ok := parseNumber(literal)
+	if !ok {
+		return nil, fmt.Errorf("invalid literal %s", literal)
+	}
+	f, _ := v.Float64()
+	return Float64(f), nil
+}
+
+func (Float64Domain) FromRat(r *big.Rat) (Number, error) {
+	f, _ := r.Float64()
+	return Float64(f), nil
+}
+
+func (Float64Domain) Bool(b bool) Number {
+	if b {
+		return Float64(1)
+	}
+	return Float64(0)
+}
+
+func (Float64Domain) Unary(op string, x Number) (Number, error) {
+	if op != "-" {
+		return nil, unsupported("Float64Domain", op)
+	}
+	return -x.(Float64), nil
+}
+
+func (Float64Domain) Binary(op string, x, y Number) (Number, error) {
+	a, b := float64(x.(Float64)), float64(y.(Float64))
+	var v float64
+	switch op {
+	case "+":
+		v = a + b
+	case "-":
+		v = a - b
+	case "*":
+		v = a * b
+	case "/":
+		v = a / b
+	case "%":
+		v = math.Mod(a, b)
+	case "//":
+		v = math.Floor(a / b)
+	case "**":
+		v = math.Pow(a, b)
+	default:
+		return nil, unsupported("Float64Domain", op)
+	}
+	return checkNaN(v, op)
+}
+
+func (Float64Domain) Call(name string, args []Number) (Number, error) {
+	fn, ok := float64Funcs[name]
+	if !ok {
+		return nil, &UnknownFunctionError{Name: name}
+	}
+	if len(args) != 1 {
+		return nil, &ArityError{Name: name, Arity: 1, Args: len(args)}
+	}
+	return checkNaN(fn(float64(args[0].(Float64))), name)
+}
+
+var float64Funcs = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"log":   math.Log,
+	"exp":   math.Exp,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+func checkNaN(v float64, op string) (Number, error) {
+	if math.IsNaN(v) {
+		return nil, fmt.Errorf("%w - %s", ErrNaN, op)
+	}
+	return Float64(v), nil
+}
+
+// Float is a Number of FloatDomain
+type Float struct {
+	V *big.Float
+}
+
+func (x Float) Sign() int        { return x.V.Sign() }
+func (x Float) Cmp(y Number) int { return x.V.Cmp(y.(Float).V) }
+func (x Float) String() string   { return x.V.Text('g', -1) }
+
+// FloatDomain evaluates formulas with big.Float of given precision and rounding mode.
+// Prec of 0 means the precision of float64. Like Float64Domain, division by zero results in infinity,
+// results of NaN are reported as ErrNaN and integer operators are not supported.
+// ** with non-integer exponents, log() and exp() are computed with float64.
+type FloatDomain struct {
+	Prec uint
+	Mode big.RoundingMode
+}
+
+func (d FloatDomain) new() *big.Float {
+	prec := d.Prec
+	if prec == 0 {
+		prec = 53
+	}
+	return new(big.Float).SetPrec(prec).SetMode(d.Mode)
+}
+
+func (d FloatDomain) Parse(literal string) (Number, error) {
+	v, ok := parseNumber(literal)
+	if !ok {
+		return nil, fmt.Errorf("invalid literal %s", literal)
+	}
+	return d.FromRat(v)
+}
+
+func (d FloatDomain) FromRat(r *big.Rat) (Number, error) {
+	return Float{d.new().SetRat(r)}, nil
+}
+
+func (d FloatDomain) Bool(b bool) Number {
+	if b {
+		return Float{d.new().SetInt64(1)}
+	}
+	return Float{d.new()}
+}
+
+func (d FloatDomain) Unary(op string, x Number) (Number, error) {
+	if op != "-" {
+		return nil, unsupported("FloatDomain", op)
+	}
+	return Float{d.new().Neg(x.(Float).V)}, nil
+}
+
+// Binary applies op to x and y. big.Float panics with big.ErrNaN for operations such as 0/0, which is returned as ErrNaN.
+func (d FloatDomain) Binary(op string, x, y Number) (v Number, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			v, err = nil, fmt.Errorf("%w - %s", ErrNaN, op)
+		}
+	}()
+
+	a, b := x.(Float).V, y.(Float).V
+	z := d.new()
+	switch op {
+	case "+":
+		return Float{z.Add(a, b)}, nil
+	case "-":
+		return Float{z.Sub(a, b)}, nil
+	case "*":
+		return Float{z.Mul(a, b)}, nil
+	case "/":
+		return Float{z.Quo(a, b)}, nil
+	case "%":
+		// a - b*trunc(a/b)
+		q := d.trunc(z.Quo(a, b))
+		return Float{q.Sub(a, q.Mul(q, b))}, nil
+	case "//":
+		return Float{d.floor(z.Quo(a, b))}, nil
+	case "**":
+		return d.pow(a, b)
+	}
+	return nil, unsupported("FloatDomain", op)
+}
+
+func (d FloatDomain) pow(a, b *big.Float) (Number, error) {
+	if !b.IsInt() || !b.IsInf() && b.MantExp(nil) > 62 {
+		fa, _ := a.Float64()
+		fb, _ := b.Float64()
+		v, err := checkNaN(math.Pow(fa, fb), "**")
+		if err != nil {
+			return nil, err
+		}
+		return Float{d.new().SetFloat64(float64(v.(Float64)))}, nil
+	}
+
+	n, _ := b.Int64()
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	z, base := d.new().SetInt64(1), d.new().Set(a)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			z.Mul(z, base)
+		}
+		base.Mul(base, base)
+	}
+	if neg {
+		z.Quo(d.new().SetInt64(1), z)
+	}
+	return Float{z}, nil
+}
+
+// trunc rounds x toward zero
+func (d FloatDomain) trunc(x *big.Float) *big.Float {
+	if x.IsInf() || x.IsInt() {
+		return d.new().Set(x)
+	}
+	i, _ := x.Int(nil)
+	return d.new().SetInt(i)
+}
+
+// floor rounds x toward negative infinity
+func (d FloatDomain) floor(x *big.Float) *big.Float {
+	t := d.trunc(x)
+	if t.Cmp(x) > 0 {
+		t.Sub(t, d.new().SetInt64(1))
+	}
+	return t
+}
+
+func (d FloatDomain) Call(name string, args []Number) (Number, error) {
+	if _, ok := float64Funcs[name]; !ok {
+		return nil, &UnknownFunctionError{Name: name}
+	}
+	if len(args) != 1 {
+		return nil, &ArityError{Name: name, Arity: 1, Args: len(args)}
+	}
+	x := args[0].(Float).V
+
+	switch name {
+	case "sqrt":
+		if x.Sign() < 0 {
+			return nil, fmt.Errorf("%w - sqrt", ErrNaN)
+		}
+		return Float{d.new().Sqrt(x)}, nil
+	case "floor":
+		return Float{d.floor(x)}, nil
+	case "ceil":
+		t := d.trunc(x)
+		if t.Cmp(x) < 0 {
+			t.Add(t, d.new().SetInt64(1))
+		}
+		return Float{t}, nil
+	case "round":
+		// half away from zero
+		half := d.new().SetFloat64(0.5)
+		if x.Sign() < 0 {
+			half.Neg(half)
+		}
+		return Float{d.trunc(half.Add(x, half))}, nil
+	}
+
+	f, _ := x.Float64()
+	v, err := checkNaN(float64Funcs[name](f), name)
+	if err != nil {
+		return nil, err
+	}
+	return Float{d.new().SetFloat64(float64(v.(Float64)))}, nil
+}
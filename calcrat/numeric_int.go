@@ -0,0 +1,146 @@
+package calcrat
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Int is a Number of IntDomain
+type Int struct {
+	V *big.Int
+}
+
+func (x Int) Sign() int        { return x.V.Sign() }
+func (x Int) Cmp(y Number) int { return x.V.Cmp(y.(Int).V) }
+func (x Int) String() string   { return x.V.String() }
+func (x Int) bitLen() int      { return x.V.BitLen() }
+
+// IntDomain evaluates formulas with big.Int. Non-integer literals are reported as ErrNonIntegerLiteral.
+// Like C, / and % truncate toward zero while // rounds toward negative infinity.
+// Negative exponents are not supported. sqrt() returns the integer square root,
+// and floor(), ceil() and round() return the argument as it is.
+type IntDomain struct {
+	// maxPowerBits is set by EvalNumber from the expression, or DefaultMaxPowerBits is used if it is zero
+	maxPowerBits int
+}
+
+func (d IntDomain) withMaxPowerBits(bits int) Domain {
+	d.maxPowerBits = bits
+	return d
+}
+
+func (d IntDomain) bits() int {
+	if d.maxPowerBits > 0 {
+		return d.maxPowerBits
+	}
+	return DefaultMaxPowerBits
+}
+
+func (IntDomain) Parse(literal string) (Number, error) {
+	v, ok := parseNumber(literal)
+	if !ok {
+		return nil, fmt.Errorf("invalid literal %s", literal)
+	}
+	if !v.IsInt() {
+		return nil, fmt.Errorf("%w - %s", ErrNonIntegerLiteral, literal)
+	}
+	return Int{new(big.Int).Set(v.Num())}, nil
+}
+
+func (IntDomain) FromRat(r *big.Rat) (Number, error) {
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%w - %s", ErrNonIntegerOperand, r.RatString())
+	}
+	return Int{new(big.Int).Set(r.Num())}, nil
+}
+
+func (IntDomain) Bool(b bool) Number {
+	if b {
+		return Int{big.NewInt(1)}
+	}
+	return Int{new(big.Int)}
+}
+
+func (IntDomain) Unary(op string, x Number) (Number, error) {
+	switch op {
+	case "-":
+		return Int{new(big.Int).Neg(x.(Int).V)}, nil
+	case "~", "^":
+		return Int{new(big.Int).Not(x.(Int).V)}, nil
+	}
+	return nil, unsupported("IntDomain", op)
+}
+
+func (d IntDomain) Binary(op string, x, y Number) (Number, error) {
+	a, b := x.(Int).V, y.(Int).V
+	z := new(big.Int)
+	switch op {
+	case "+":
+		return Int{z.Add(a, b)}, nil
+	case "-":
+		return Int{z.Sub(a, b)}, nil
+	case "*":
+		return Int{z.Mul(a, b)}, nil
+	case "&":
+		return Int{z.And(a, b)}, nil
+	case "|":
+		return Int{z.Or(a, b)}, nil
+	case "^":
+		return Int{z.Xor(a, b)}, nil
+	case "/", "%", "//":
+		if b.Sign() == 0 {
+			return nil, &DivisionByZeroError{}
+		}
+		q, r := z.QuoRem(a, b, new(big.Int))
+		switch op {
+		case "/":
+			return Int{q}, nil
+		case "%":
+			return Int{r}, nil
+		}
+		if r.Sign() != 0 && r.Sign() != b.Sign() {
+			q.Sub(q, big.NewInt(1))
+		}
+		return Int{q}, nil
+	case "<<", ">>":
+		if b.Sign() < 0 {
+			return nil, fmt.Errorf("negative shift count - %s", b)
+		}
+		if !b.IsInt64() || (op == "<<" && b.Int64() > int64(d.bits()-a.BitLen())) {
+			return nil, fmt.Errorf("%w - %s %s %s", ErrPowerTooLarge, a, op, b)
+		}
+		if op == "<<" {
+			return Int{z.Lsh(a, uint(b.Int64()))}, nil
+		}
+		// Rsh rounds toward negative infinity like arithmetic shift
+		return Int{z.Rsh(a, uint(b.Int64()))}, nil
+	case "**":
+		if b.Sign() < 0 {
+			return nil, unsupported("IntDomain", "negative exponent")
+		}
+		if a.BitLen() > 1 && (!b.IsInt64() || b.Int64() > int64(d.bits()/(a.BitLen()-1))) {
+			return nil, fmt.Errorf("%w - %s ** %s", ErrPowerTooLarge, a, b)
+		}
+		return Int{z.Exp(a, b, nil)}, nil
+	}
+	return nil, unsupported("IntDomain", op)
+}
+
+func (IntDomain) Call(name string, args []Number) (Number, error) {
+	switch name {
+	case "sqrt", "floor", "ceil", "round":
+	default:
+		return nil, &UnknownFunctionError{Name: name}
+	}
+	if len(args) != 1 {
+		return nil, &ArityError{Name: name, Arity: 1, Args: len(args)}
+	}
+	x := args[0].(Int).V
+	if name != "sqrt" {
+		return args[0], nil
+	}
+	if x.Sign() < 0 {
+		return nil, fmt.Errorf("%w - sqrt", ErrNaN)
+	}
+	return Int{new(big.Int).Sqrt(x)}, nil
+}
@@ -0,0 +1,150 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestDomainsEvaluateFormulas(t *testing.T) {
+	domains := []calcrat.Domain{
+		calcrat.RatDomain{},
+		calcrat.Float64Domain{},
+		calcrat.FloatDomain{Prec: 200, Mode: big.ToNearestEven},
+		calcrat.IntDomain{},
+	}
+	tests := []struct {
+		formula string
+		exp     []string
+	}{
+		{"7 / 2", []string{"7/2", "3.5", "3.5", "3"}},
+		{"-7 / 2", []string{"-7/2", "-3.5", "-3.5", "-3"}},
+		{"-7 % 2", []string{"-1", "-1", "-1", "-1"}},
+		{"-7 // 2", []string{"-4", "-4", "-4", "-4"}},
+		{"2 ** 10 - 1", []string{"1023", "1023", "1023", "1023"}},
+		{"max(x, 3) * (x > 1 ? 2 : 3)", []string{"8", "8", "8", "8"}},
+		{"abs(1 - x) + 0x10", []string{"19", "19", "19", "19"}},
+		{"x == 4 && !(x < 0) || 1 / 0", []string{"1", "1", "1", "1"}},
+		{"if(x - 4, 1 / 0, 10 % 4)", []string{"2", "2", "2", "2"}},
+	}
+
+	for _, test := range tests {
+		for i, d := range domains {
+			vars, err := calcrat.Variables{"x": big.NewRat(4, 1)}.Numbers(d)
+			OK(t, err)
+			v, err := calcrat.CalcNumber(test.formula, d, vars)
+			OK(t, err)
+			EQUALS(t, "formula should be evaluated in domain: "+test.formula, test.exp[i], v.String())
+		}
+	}
+}
+
+func TestFloatDomainsSupportRealFunctions(t *testing.T) {
+	v, err := calcrat.CalcNumber("sqrt(2) * sqrt(2)", calcrat.Float64Domain{}, nil)
+	OK(t, err)
+	EQUALS(t, "float64 should be approximate", "2.0000000000000004", v.String())
+
+	v, err = calcrat.CalcNumber("sqrt(2)", calcrat.FloatDomain{Prec: 100}, nil)
+	OK(t, err)
+	EQUALS(t, "big.Float should have given precision", "1.414213562373095048801688724209", v.String())
+
+	v, err = calcrat.CalcNumber("round(log(exp(3))) + floor(-1.5) + ceil(1.2)", calcrat.Float64Domain{}, nil)
+	OK(t, err)
+	EQUALS(t, "functions should be evaluated", "3", v.String())
+
+	v, err = calcrat.CalcNumber("1 / 3", calcrat.FloatDomain{Prec: 8, Mode: big.ToZero}, nil)
+	OK(t, err)
+	v2, err := calcrat.CalcNumber("1 / 3", calcrat.FloatDomain{Prec: 8, Mode: big.AwayFromZero}, nil)
+	OK(t, err)
+	ASSERT(t, "rounding mode should be applied", v.Cmp(v2) < 0)
+
+	v, err = calcrat.CalcNumber("-1 / 0", calcrat.Float64Domain{}, nil)
+	OK(t, err)
+	EQUALS(t, "division by zero should result in infinity", "-Inf", v.String())
+
+	for _, d := range []calcrat.Domain{calcrat.Float64Domain{}, calcrat.FloatDomain{}} {
+		for _, formula := range []string{"0 / 0", "sqrt(-1)", "1 % 0"} {
+			_, err = calcrat.CalcNumber(formula, d, nil)
+			ASSERT(t, "NaN should be reported: "+formula, errors.Is(err, calcrat.ErrNaN))
+		}
+	}
+}
+
+func TestEvalNumberEnforcesLimitsAndOptions(t *testing.T) {
+	e, err := calcrat.CompileLimits("x * x * x + 1+1+1+1+1+1+1+1+1+1", calcrat.Limits{MaxBits: 64, MaxSteps: 30})
+	OK(t, err)
+	for _, d := range []calcrat.Domain{calcrat.RatDomain{}, calcrat.IntDomain{}} {
+		vars, err := calcrat.Variables{"x": big.NewRat(1<<30, 1)}.Numbers(d)
+		OK(t, err)
+		_, err = e.EvalNumber(d, vars)
+		EQUALS(t, "large intermediate result should be rejected", "MaxBits", limitOf(err))
+		EQUALS(t, "expression should be reported", "limit exceeded - MaxBits 64 by x * x * x", err.Error())
+
+		vars, err = calcrat.Variables{"x": big.NewRat(1, 1)}.Numbers(d)
+		OK(t, err)
+		v, err := e.EvalNumber(d, vars)
+		OK(t, err)
+		EQUALS(t, "value within limits should be evaluated", "11", v.String())
+	}
+
+	e, err = calcrat.CompileLimits("1+1+1+1+1+1+1+1+1+1+1", calcrat.Limits{MaxSteps: 20})
+	OK(t, err)
+	_, err = e.EvalNumber(calcrat.Float64Domain{}, nil)
+	EQUALS(t, "long evaluation should be rejected", "MaxSteps", limitOf(err))
+
+	e, err = calcrat.Compile("2**100")
+	OK(t, err)
+	e = e.WithMaxPowerBits(64)
+	for _, d := range []calcrat.Domain{calcrat.RatDomain{}, calcrat.IntDomain{}} {
+		_, err = e.EvalNumber(d, nil)
+		ASSERT(t, "power exceeding max power bits should be rejected", errors.Is(err, calcrat.ErrPowerTooLarge))
+	}
+
+	_, err = calcrat.Variables{"x": nil}.Numbers(calcrat.RatDomain{})
+	ASSERT(t, "nil variable should be rejected", err != nil)
+}
+
+func TestDomainSpecificErrors(t *testing.T) {
+	_, err := calcrat.CalcNumber("1.5 + 1", calcrat.IntDomain{}, nil)
+	ASSERT(t, "non-integer literal should be rejected", errors.Is(err, calcrat.ErrNonIntegerLiteral))
+
+	_, err = calcrat.Variables{"x": big.NewRat(1, 2)}.Numbers(calcrat.IntDomain{})
+	ASSERT(t, "non-integer variable should be rejected", errors.Is(err, calcrat.ErrNonIntegerOperand))
+
+	_, err = calcrat.CalcNumber("2 ** -1", calcrat.IntDomain{}, nil)
+	ASSERT(t, "negative exponent should be rejected", errors.Is(err, calcrat.ErrUnsupportedOperation))
+
+	_, err = calcrat.CalcNumber("7 / (3 - 3)", calcrat.IntDomain{}, nil)
+	var de *calcrat.DivisionByZeroError
+	ASSERT(t, "division by zero should be reported", errors.As(err, &de))
+	EQUALS(t, "divisor should be reported", "(3 - 3)", de.Expr)
+
+	_, err = calcrat.CalcNumber("7 / (3 - 3)", calcrat.RatDomain{}, nil)
+	ASSERT(t, "division by zero should be reported", errors.As(err, &de))
+	EQUALS(t, "divisor should be reported", "(3 - 3)", de.Expr)
+
+	_, err = calcrat.CalcNumber("1 + 2**(1/2)", calcrat.RatDomain{}, nil)
+	ASSERT(t, "non-integer exponent should be rejected", errors.Is(err, calcrat.ErrNonIntegerExponent))
+	ASSERT(t, "expression should be reported: "+err.Error(), strings.Contains(err.Error(), "2**(1/2)"))
+
+	_, err = calcrat.CalcNumber("1 << 9223372036854775807", calcrat.IntDomain{}, nil)
+	ASSERT(t, "large shift should be rejected", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	_, err = calcrat.CalcNumber("4 ** 4611686018427387904", calcrat.IntDomain{}, nil)
+	ASSERT(t, "large power should be rejected", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	_, err = calcrat.CalcNumber("1 << 2", calcrat.Float64Domain{}, nil)
+	ASSERT(t, "integer operator should be rejected", errors.Is(err, calcrat.ErrUnsupportedOperation))
+
+	_, err = calcrat.CalcNumber("sqrt(4)", calcrat.RatDomain{}, nil)
+	var fe *calcrat.UnknownFunctionError
+	ASSERT(t, "sqrt should not be available for rationals", errors.As(err, &fe))
+
+	v, err := calcrat.CalcNumber("-7 >> 1 | 0b1000", calcrat.IntDomain{}, nil)
+	OK(t, err)
+	EQUALS(t, "bitwise operators should be evaluated", "-4", v.String())
+}
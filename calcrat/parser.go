@@ -0,0 +1,282 @@
+package calcrat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// parser is a precedence climbing parser driven by binaryOps and prefixOps
+type parser struct {
+	formula string
+	tokens  []token
+	next    int
+	limits  Limits
+	depth   int
+}
+
+// Parse parses given formula and returns its AST
+func Parse(formula string) (Expr, error) {
+	return ParseLimits(formula, Limits{})
+}
+
+// ParseLimits parses given formula within MaxLength, MaxDepth and MaxNodes of limits and returns its AST
+func ParseLimits(formula string, limits Limits) (Expr, error) {
+	if limits.MaxLength > 0 && len(formula) > limits.MaxLength {
+		return nil, &LimitExceededError{Limit: "MaxLength", Max: limits.MaxLength}
+	}
+	p := &parser{
+		formula: formula,
+		tokens:  tokenize(formula),
+		limits:  limits,
+	}
+
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		if t.text == ")" {
+			return nil, p.errorAt(t, "operator or end of formula")
+		}
+		return nil, p.errorAt(t, "operator")
+	}
+	if err := limits.check(x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// enter counts the nesting of recursive parsing, so that deeply nested formulas are rejected early.
+// The depth of recursion never exceeds the depth of the AST.
+func (p *parser) enter() error {
+	p.depth++
+	if p.limits.MaxDepth > 0 && p.depth > p.limits.MaxDepth {
+		return &LimitExceededError{Limit: "MaxDepth", Max: p.limits.MaxDepth}
+	}
+	return nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next], true
+	}
+	return token{"", len(p.formula)}, false
+}
+
+func (p *parser) errorAt(t token, expected string) error {
+	return newSyntaxError(p.formula, t.pos, t.text, expected)
+}
+
+// parseExpr parses a conditional expression, which has the lowest precedence and is right associative
+func (p *parser) parseExpr() (Expr, error) {
+	defer func() { p.depth-- }()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+
+	c, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := p.peek()
+	if !ok || q.text != "?" {
+		return c, nil
+	}
+	p.next++
+
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	colon, ok := p.peek()
+	if !ok || colon.text != ":" {
+		return nil, p.errorAt(colon, ":")
+	}
+	p.next++
+
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &CondExpr{c, q.pos, then, colon.pos, els}, nil
+}
+
+// parseBinary parses binary operations whose precedence is not lower than minPrec
+func (p *parser) parseBinary(minPrec int) (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek()
+		if !ok {
+			return left, nil
+		}
+		b, ok := binaryOps[t.text]
+		if !ok || b.prec < minPrec {
+			return left, nil
+		}
+		p.next++
+		if t.text == "%" && p.ambiguousPercent(left, t) {
+			return nil, p.errorAt(t, "space after percent or around remainder")
+		}
+		// 3 m**2 could be read as both 3 * m**2 and (3 m)**2
+		if _, ok := left.(*UnitLit); ok && t.text == "**" {
+			return nil, p.errorAt(t, "operator other than ** after unit literal")
+		}
+
+		nextPrec := b.prec + 1
+		if b.assoc == rightAssoc {
+			nextPrec = b.prec
+		}
+		// the right operand of a right associative operator such as x**x**x nests as deep as the chain
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseBinary(nextPrec)
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{left, t.pos, t.text, right}
+	}
+}
+
+// ambiguousPercent reports whether remainder operator t, which directly follows numeric literal left
+// and is directly followed by a prefix operator or a bracket such as 15%-2, could be read as percent as well
+func (p *parser) ambiguousPercent(left Expr, t token) bool {
+	if _, ok := left.(*NumberLit); !ok || left.End() != t.pos {
+		return false
+	}
+	r, ok := p.peek()
+	if !ok || r.pos != t.pos+1 {
+		return false
+	}
+	_, prefix := prefixOps[r.text]
+	return prefix || r.text == "("
+}
+
+// parseUnary parses an operand which may be preceded by prefix operators
+func (p *parser) parseUnary() (Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorAt(t, "operand")
+	}
+	if _, ok := prefixOps[t.text]; !ok {
+		return p.parseOperand()
+	}
+	p.next++
+
+	defer func() { p.depth-- }()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseBinary(prefixPrec + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{t.pos, t.text, x}, nil
+}
+
+// parseOperand parses a literal, an identifier, a function call or an expression enclosed in brackets
+func (p *parser) parseOperand() (Expr, error) {
+	t, _ := p.peek()
+	if isPunct(t.text) && t.text != "(" {
+		return nil, p.errorAt(t, "operand")
+	}
+	p.next++
+
+	if t.text == "(" {
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		r, ok := p.peek()
+		if !ok {
+			return nil, p.errorAt(r, ")")
+		}
+		if r.text != ")" {
+			return nil, p.errorAt(r, "operator")
+		}
+		p.next++
+		return &Paren{t.pos, x, r.pos}, nil
+	}
+
+	if isNumeric(t.text) {
+		if _, ok := newLiteral(t.text, t.pos); ok {
+			return &NumberLit{t.pos, t.text}, nil
+		}
+		if u, ok := unitLit(t); ok {
+			return u, nil
+		}
+		return nil, &InvalidLiteralError{Formula: p.formula, Offset: t.pos, Literal: t.text}
+	}
+
+	id := &Ident{t.pos, t.text}
+	if l, ok := p.peek(); ok && l.text == "(" {
+		p.next++
+		return p.parseCall(id, l.pos)
+	}
+	return id, nil
+}
+
+// parseCall parses comma separated arguments of the function call until closing bracket
+func (p *parser) parseCall(fun *Ident, lparen int) (Expr, error) {
+	c := &Call{Fun: fun, Lparen: lparen, Args: []Expr{}}
+	if r, ok := p.peek(); ok && r.text == ")" {
+		p.next++
+		c.Rparen = r.pos
+		return c, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		c.Args = append(c.Args, arg)
+
+		r, ok := p.peek()
+		if !ok || (r.text != "," && r.text != ")") {
+			return nil, p.errorAt(r, ", or )")
+		}
+		p.next++
+		if r.text == ")" {
+			c.Rparen = r.pos
+			return c, nil
+		}
+	}
+}
+
+// unitLit splits token into a numeric literal and a unit separated by white spaces such as 3 m
+func unitLit(t token) (*UnitLit, bool) {
+	i := strings.LastIndexFunc(t.text, unicode.IsSpace)
+	if i < 0 {
+		return nil, false
+	}
+	number, unit := strings.TrimSpace(t.text[:i]), t.text[i+1:]
+	if _, ok := newLiteral(number, t.pos); !ok || !isUnitName(unit) {
+		return nil, false
+	}
+	return &UnitLit{&NumberLit{t.pos, number}, t.pos + i + 1, unit}, true
+}
+
+// isUnitName reports whether s is an identifier such as m, kWh or µs
+func isUnitName(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && (i == 0 || (r != '_' && !unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isPunct reports whether token is an operator or a delimiter
+func isPunct(token string) bool {
+	return strings.IndexByte(punct, token[0]) >= 0
+}
+
+// isNumeric reports whether token is intended to be a numeric literal
+func isNumeric(token string) bool {
+	return token[0] == '.' || ('0' <= token[0] && token[0] <= '9')
+}
@@ -0,0 +1,143 @@
+package calcrat_test
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+var errSkip = errors.New("not comparable")
+
+// evalConstant evaluates a Go expression with go/constant as reference implementation
+func evalConstant(e ast.Expr) (constant.Value, error) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(e.Value, e.Kind, 0), nil
+	case *ast.ParenExpr:
+		return evalConstant(e.X)
+	case *ast.UnaryExpr:
+		x, err := evalConstant(e.X)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == token.XOR {
+			x = constant.ToInt(x)
+			if x.Kind() != constant.Int {
+				return nil, calcrat.ErrNonIntegerOperand
+			}
+		}
+		return constant.UnaryOp(e.Op, x, 0), nil
+	case *ast.BinaryExpr:
+		x, err := evalConstant(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalConstant(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.QUO:
+			if constant.Sign(y) == 0 {
+				return nil, calcrat.ErrDivisionByZero
+			}
+		case token.REM, token.SHL, token.SHR, token.AND, token.OR, token.XOR:
+			x, y = constant.ToInt(x), constant.ToInt(y)
+			if x.Kind() != constant.Int || y.Kind() != constant.Int {
+				return nil, calcrat.ErrNonIntegerOperand
+			}
+			if e.Op == token.REM && constant.Sign(y) == 0 {
+				return nil, calcrat.ErrDivisionByZero
+			}
+			if e.Op == token.SHL || e.Op == token.SHR {
+				n, ok := constant.Uint64Val(y)
+				if !ok || n > 256 {
+					return nil, errSkip
+				}
+				return constant.Shift(x, e.Op, uint(n)), nil
+			}
+		}
+		return constant.BinaryOp(x, e.Op, y), nil
+	}
+	return nil, fmt.Errorf("unsupported expression %T", e)
+}
+
+func assertSameAsGo(t *testing.T, formula string) {
+	e, err := parser.ParseExpr(formula)
+	OK(t, err)
+
+	expected, expectedErr := evalConstant(e)
+	if expectedErr == errSkip {
+		return
+	}
+
+	actual, err := calcrat.Calc(formula, nil, nil)
+	if expectedErr != nil {
+		ASSERT(t, "error should be returned: "+formula, errors.Is(err, expectedErr))
+		return
+	}
+	OK(t, err)
+
+	r, _ := new(big.Rat).SetString(constant.Num(expected).ExactString() + "/" + constant.Denom(expected).ExactString())
+	EQUALS(t, "result should match go/constant: "+formula, r.RatString(), actual.RatString())
+}
+
+func TestPrecedenceMatchesGoExhaustively(t *testing.T) {
+	ops := []string{"+", "-", "*", "/", "%", "<<", ">>", "&", "|", "^"}
+	templates := []string{
+		"6 %s 3 %s 5 %s 2",
+		"(6 %s 3) %s 5 %s 2",
+		"6 %s (3 %s 5) %s 2",
+		"6 %s 3 %s (5 %s 2)",
+		"-6 %s 3 %s -5 %s 2",
+		"6 %s ^3 %s 5 %s -2",
+		"12 %s 0 %s 7 %s 1",
+	}
+
+	for _, tmpl := range templates {
+		for _, a := range ops {
+			for _, b := range ops {
+				for _, c := range ops {
+					assertSameAsGo(t, fmt.Sprintf(tmpl, a, b, c))
+				}
+			}
+		}
+	}
+}
+
+func TestPrecedenceMatchesGoForRandomFormulas(t *testing.T) {
+	g := &formulaGen{
+		r:      rand.New(rand.NewSource(1)),
+		leaves: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+		prefix: []string{"-", "+", "^"},
+		binary: []string{"+", "-", "*", "/", "%", "<<", ">>", "&", "|", "^"},
+	}
+	for i := 0; i < 5000; i++ {
+		assertSameAsGo(t, g.gen(6))
+	}
+}
+
+func TestLongChainIsLeftAssociative(t *testing.T) {
+	vars := calcrat.Variables{
+		"a": big.NewRat(100, 1),
+		"b": big.NewRat(3, 1),
+		"c": big.NewRat(4, 1),
+		"d": big.NewRat(5, 1),
+		"e": big.NewRat(6, 1),
+		"f": big.NewRat(8, 1),
+		"g": big.NewRat(7, 1),
+	}
+	expected := big.NewRat(307, 4)
+	actual, err := calcrat.Calc("a-b*c-d+e/f-g", vars, nil)
+	EQUALS(t, "long chain should be evaluated from left", expected.RatString(), actual.RatString())
+	OK(t, err)
+}
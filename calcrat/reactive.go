@@ -0,0 +1,269 @@
+package calcrat
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// Engine holds named formulas and input variables, and recomputes the formulas when inputs change.
+// Only the formulas which depend on the changed inputs transitively are recomputed.
+// Engine is safe for concurrent use. Each update is applied atomically,
+// so that snapshots and subscribers never observe a partially recomputed state.
+type Engine struct {
+	mu         sync.Mutex
+	sheet      *Sheet
+	functions  Functions
+	order      []string
+	dependents map[string][]string
+	inputs     Variables
+	env        Variables
+	errs       map[string]error
+	version    uint64
+
+	// notifyMu serializes notifications, so that subscribers receive updates in the order of versions
+	notifyMu    sync.Mutex
+	subscribers map[int]func(Update)
+	nextID      int
+}
+
+// Update describes the result of an update of an Engine.
+// Changed holds the formulas whose values changed and Errors holds the formulas which failed in the update.
+type Update struct {
+	Version uint64
+	Changed Variables
+	Errors  map[string]error
+}
+
+// Snapshot is a consistent copy of the state of an Engine.
+type Snapshot struct {
+	Version uint64
+	Inputs  Variables
+	Values  Variables
+	Errors  map[string]error
+}
+
+// NewEngine returns an empty Engine which evaluates formulas with given functions in addition to the built-in ones
+func NewEngine(functions Functions) *Engine {
+	return &Engine{
+		sheet:       NewSheet(),
+		functions:   functions,
+		order:       []string{},
+		dependents:  map[string][]string{},
+		inputs:      Variables{},
+		env:         Variables{},
+		errs:        map[string]error{},
+		subscribers: map[int]func(Update){},
+	}
+}
+
+// Define compiles formula and sets it to given name, replacing existing one.
+// The formula and its dependents are recomputed. CycleError is returned and nothing is changed
+// if the formula makes a cycle.
+func (e *Engine) Define(name, formula string) error {
+	e.mu.Lock()
+
+	prev, existed := e.sheet.cells[name]
+	if err := e.sheet.Set(name, formula); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	order, err := e.sheet.Order()
+	if err != nil {
+		if existed {
+			e.sheet.cells[name] = prev
+		} else {
+			e.sheet.Delete(name)
+		}
+		e.mu.Unlock()
+		return err
+	}
+
+	e.order = order
+	e.dependents = map[string][]string{}
+	for _, n := range order {
+		for _, dep := range e.sheet.cells[n].names {
+			e.dependents[dep] = append(e.dependents[dep], n)
+		}
+	}
+
+	e.apply([]string{name}, true)
+	return nil
+}
+
+// Set sets the input variable of given name and recomputes the formulas which depend on it.
+// An error is returned and nothing is changed if v is nil.
+func (e *Engine) Set(name string, v *big.Rat) error {
+	return e.SetAll(Variables{name: v})
+}
+
+// SetAll sets the input variables at once and recomputes the formulas which depend on them.
+// Subscribers receive a single update for all of the variables.
+// An error is returned and nothing is changed if any of the values is nil.
+func (e *Engine) SetAll(variables Variables) error {
+	for name, v := range variables {
+		if v == nil {
+			return fmt.Errorf("invalid value of %s - nil", name)
+		}
+	}
+
+	e.mu.Lock()
+	names := make([]string, 0, len(variables))
+	for name, v := range variables {
+		e.inputs[name] = new(big.Rat).Set(v)
+		if _, ok := e.sheet.cells[name]; !ok {
+			e.env[name] = e.inputs[name]
+		}
+		names = append(names, name)
+	}
+	e.apply(names, false)
+	return nil
+}
+
+// apply recomputes the formulas which depend on given names in topological order and notifies subscribers.
+// If self is true, the formulas of given names are also recomputed.
+// apply must be called with mu locked and unlocks it.
+func (e *Engine) apply(names []string, self bool) {
+	affected := map[string]bool{}
+	queue := []string{}
+	for _, name := range names {
+		if self {
+			affected[name] = true
+		}
+		queue = append(queue, name)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, dep := range e.dependents[name] {
+			if !affected[dep] {
+				affected[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	e.version++
+	u := Update{Version: e.version, Changed: Variables{}, Errors: map[string]error{}}
+	for _, name := range e.order {
+		if !affected[name] {
+			continue
+		}
+		prev, hadValue := e.env[name]
+		if _, ok := e.errs[name]; ok {
+			hadValue = false
+		}
+
+		v, err := e.eval(name)
+		if err != nil {
+			e.errs[name] = err
+			u.Errors[name] = err
+			if input, ok := e.inputs[name]; ok {
+				e.env[name] = input
+			} else {
+				delete(e.env, name)
+			}
+			continue
+		}
+		delete(e.errs, name)
+		e.env[name] = v
+		if !hadValue || prev.Cmp(v) != 0 {
+			u.Changed[name] = new(big.Rat).Set(v)
+		}
+	}
+
+	e.notifyMu.Lock()
+	e.mu.Unlock()
+	defer e.notifyMu.Unlock()
+	for _, fn := range e.subscribers {
+		fn(u)
+	}
+}
+
+func (e *Engine) eval(name string) (*big.Rat, error) {
+	if err := e.sheet.failedDependency(name, e.errs); err != nil {
+		return nil, err
+	}
+	return e.sheet.cells[name].EvalFunctions(e.env, e.functions, nil)
+}
+
+// Get returns the current value of the formula or the input variable of given name
+func (e *Engine) Get(name string) (*big.Rat, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err, ok := e.errs[name]; ok {
+		return nil, err
+	}
+	if _, ok := e.sheet.cells[name]; !ok {
+		if v, ok := e.inputs[name]; ok {
+			return new(big.Rat).Set(v), nil
+		}
+		return nil, &UnknownIdentifierError{Name: name}
+	}
+	return new(big.Rat).Set(e.env[name]), nil
+}
+
+// Snapshot returns a consistent copy of the inputs, the values of formulas and their errors
+func (e *Engine) Snapshot() Snapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := Snapshot{
+		Version: e.version,
+		Inputs:  make(Variables, len(e.inputs)),
+		Values:  make(Variables, len(e.order)),
+		Errors:  make(map[string]error, len(e.errs)),
+	}
+	for name, v := range e.inputs {
+		s.Inputs[name] = new(big.Rat).Set(v)
+	}
+	for _, name := range e.order {
+		if err, ok := e.errs[name]; ok {
+			s.Errors[name] = err
+		} else {
+			s.Values[name] = new(big.Rat).Set(e.env[name])
+		}
+	}
+	return s
+}
+
+// Subscribe registers fn to be called with each update in the order of versions.
+// fn must not update the engine. The returned function cancels the subscription.
+func (e *Engine) Subscribe(fn func(Update)) func() {
+	e.notifyMu.Lock()
+	defer e.notifyMu.Unlock()
+
+	id := e.nextID
+	e.nextID++
+	e.subscribers[id] = fn
+	return func() {
+		e.notifyMu.Lock()
+		defer e.notifyMu.Unlock()
+		delete(e.subscribers, id)
+	}
+}
+
+// Watch returns a channel which receives each update in the order of versions.
+// Updates of the engine block while the channel is full, so the channel must be drained until cancelled.
+// The returned function cancels the subscription and closes the channel.
+// An update blocked on the channel is dropped when the subscription is cancelled.
+func (e *Engine) Watch(buffer int) (<-chan Update, func()) {
+	ch := make(chan Update, buffer)
+	done := make(chan struct{})
+	cancel := e.Subscribe(func(u Update) {
+		select {
+		case ch <- u:
+		case <-done:
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			// done is closed first to release the notification blocked on ch, which holds notifyMu
+			close(done)
+			cancel()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestEngineRecomputesDependentsOnSet(t *testing.T) {
+	calls := 0
+	e := calcrat.NewEngine(calcrat.Functions{
+		"count": {Arity: 1, Call: func(args []*big.Rat) (*big.Rat, error) {
+			calls++
+			return args[0], nil
+		}},
+	})
+	OK(t, e.Define("interest", "principal * rate"))
+	OK(t, e.Define("total", "principal + interest"))
+	OK(t, e.Define("fee", "count(flat)"))
+
+	e.SetAll(calcrat.Variables{"principal": big.NewRat(1000, 1), "rate": big.NewRat(5, 100), "flat": big.NewRat(3, 1)})
+	EQUALS(t, "fee should be computed once", 1, calls)
+
+	var updates []calcrat.Update
+	cancel := e.Subscribe(func(u calcrat.Update) {
+		updates = append(updates, u)
+	})
+	e.Set("rate", big.NewRat(1, 10))
+	EQUALS(t, "formulas not depending on rate should not be recomputed", 1, calls)
+
+	v, err := e.Get("total")
+	OK(t, err)
+	EQUALS(t, "total should be recomputed", "1100", v.RatString())
+	EQUALS(t, "one update should be notified", 1, len(updates))
+	EQUALS(t, "changed formulas should be notified", 2, len(updates[0].Changed))
+	EQUALS(t, "changed value should be notified", "100", updates[0].Changed["interest"].RatString())
+
+	e.Set("principal", big.NewRat(1000, 1))
+	EQUALS(t, "update should be notified", 2, len(updates))
+	EQUALS(t, "unchanged values should not be notified", 0, len(updates[1].Changed))
+
+	cancel()
+	e.Set("rate", big.NewRat(2, 10))
+	EQUALS(t, "cancelled subscriber should not be notified", 2, len(updates))
+}
+
+func TestEngineReportsErrors(t *testing.T) {
+	e := calcrat.NewEngine(nil)
+	OK(t, e.Define("ratio", "a / b"))
+	OK(t, e.Define("percent", "ratio * 100"))
+
+	e.SetAll(calcrat.Variables{"a": big.NewRat(1, 1), "b": big.NewRat(0, 1)})
+	_, err := e.Get("percent")
+	ASSERT(t, "dependent of failed formula should fail", errors.Is(err, calcrat.ErrDivisionByZero))
+
+	e.Set("b", big.NewRat(4, 1))
+	v, err := e.Get("percent")
+	OK(t, err)
+	EQUALS(t, "formula should recover", "25", v.RatString())
+
+	err = e.Define("a", "percent + 1")
+	var ce *calcrat.CycleError
+	ASSERT(t, "cycle should be rejected", errors.As(err, &ce))
+	v, err = e.Get("a")
+	OK(t, err)
+	EQUALS(t, "input should be kept after rejected definition", "1", v.RatString())
+}
+
+func TestEngineSnapshotsAreConsistentUnderConcurrentUpdates(t *testing.T) {
+	e := calcrat.NewEngine(nil)
+	OK(t, e.Define("sum", "a + b"))
+	OK(t, e.Define("diff", "sum - a - b"))
+	e.SetAll(calcrat.Variables{"a": big.NewRat(0, 1), "b": big.NewRat(0, 1)})
+
+	ch, cancel := e.Watch(16)
+	done := make(chan []uint64)
+	go func() {
+		versions := []uint64{}
+		for u := range ch {
+			versions = append(versions, u.Version)
+		}
+		done <- versions
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := []string{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := "a"
+				if j%2 == 0 {
+					name = "b"
+				}
+				e.Set(name, big.NewRat(int64(i*j), 1))
+				s := e.Snapshot()
+				sum := new(big.Rat).Add(s.Inputs["a"], s.Inputs["b"])
+				if s.Values["sum"].Cmp(sum) != 0 || s.Values["diff"].Sign() != 0 {
+					mu.Lock()
+					failures = append(failures, s.Values["sum"].RatString())
+					mu.Unlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+
+	EQUALS(t, "snapshots should be consistent", []string{}, failures)
+	versions := <-done
+	EQUALS(t, "every update should be notified", 800, len(versions))
+	for i := 1; i < len(versions); i++ {
+		ASSERT(t, "updates should be notified in order", versions[i-1] < versions[i])
+	}
+}
+
+func TestEngineWatchCanBeCancelledWhileBlocked(t *testing.T) {
+	e := calcrat.NewEngine(nil)
+	OK(t, e.Define("double", "x * 2"))
+	_, cancel := e.Watch(0)
+
+	set := make(chan struct{})
+	go func() {
+		e.Set("x", big.NewRat(1, 1))
+		close(set)
+	}()
+	// let the update block on the unread channel
+	time.Sleep(10 * time.Millisecond)
+
+	cancelled := make(chan struct{})
+	go func() {
+		cancel()
+		close(cancelled)
+	}()
+	for _, c := range []chan struct{}{cancelled, set} {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal("cancel should release the blocked update")
+		}
+	}
+
+	OK(t, e.Set("x", big.NewRat(2, 1)))
+	v, err := e.Get("double")
+	OK(t, err)
+	EQUALS(t, "updates should continue after cancel", "4", v.RatString())
+}
+
+func TestEngineRejectsNilInputs(t *testing.T) {
+	e := calcrat.NewEngine(nil)
+	OK(t, e.Define("double", "x * 2"))
+	OK(t, e.Set("x", big.NewRat(1, 1)))
+
+	err := e.SetAll(calcrat.Variables{"x": big.NewRat(2, 1), "y": nil})
+	ASSERT(t, "nil input should be rejected", err != nil)
+	v, err := e.Get("double")
+	OK(t, err)
+	EQUALS(t, "nothing should be changed", "2", v.RatString())
+}
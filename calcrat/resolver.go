@@ -0,0 +1,44 @@
+package calcrat
+
+import (
+	"context"
+	"errors"
+	"math/big"
+)
+
+// Resolver resolves the value of a named value in a formula.
+// Resolve returns UnknownIdentifierError if the name is not known to the resolver.
+type Resolver interface {
+	Resolve(ctx context.Context, name string) (*big.Rat, error)
+}
+
+// ResolverFunc is an adapter to use an ordinary function as Resolver
+type ResolverFunc func(ctx context.Context, name string) (*big.Rat, error)
+
+// Resolve calls f(ctx, name)
+func (f ResolverFunc) Resolve(ctx context.Context, name string) (*big.Rat, error) {
+	return f(ctx, name)
+}
+
+// Chain returns a Resolver which consults given resolvers in order until one of them knows the name.
+// Errors other than UnknownIdentifierError are returned immediately. nil resolvers are skipped.
+func Chain(resolvers ...Resolver) Resolver {
+	return chain(resolvers)
+}
+
+type chain []Resolver
+
+func (c chain) Resolve(ctx context.Context, name string) (*big.Rat, error) {
+	for _, r := range c {
+		if r == nil {
+			continue
+		}
+		v, err := r.Resolve(ctx, name)
+		var ue *UnknownIdentifierError
+		if errors.As(err, &ue) {
+			continue
+		}
+		return v, err
+	}
+	return nil, &UnknownIdentifierError{Name: name}
+}
@@ -0,0 +1,81 @@
+package calcrat_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestCalcContextResolvesIdentifiers(t *testing.T) {
+	resolver := calcrat.Chain(
+		calcrat.Variables{"price": big.NewRat(100, 1)},
+		calcrat.Handler(func(name string) *big.Rat {
+			if name == "rate" {
+				return big.NewRat(1, 10)
+			}
+			return nil
+		}),
+	)
+
+	v, err := calcrat.CalcContext(context.Background(), "price * (1 + rate)", resolver)
+	OK(t, err)
+	EQUALS(t, "identifiers should be resolved in order", "110", v.RatString())
+
+	_, err = calcrat.CalcContext(context.Background(), "price * tax", resolver)
+	var ue *calcrat.UnknownIdentifierError
+	ASSERT(t, "unknown identifier should be reported", errors.As(err, &ue))
+	EQUALS(t, "name should be reported", "tax", ue.Name)
+
+	_, err = calcrat.CalcContext(context.Background(), "x", nil)
+	ASSERT(t, "nil resolver should know no identifiers", errors.As(err, &ue))
+
+	v, err = calcrat.CalcContext(context.Background(), "1 + 2", nil)
+	OK(t, err)
+	EQUALS(t, "formula without identifiers should be evaluated with nil resolver", "3", v.RatString())
+
+	_, err = calcrat.CalcContext(context.Background(), "x", calcrat.Chain(nil))
+	ASSERT(t, "nil resolver in chain should be skipped", errors.As(err, &ue))
+}
+
+func TestCalcContextWrapsResolverErrors(t *testing.T) {
+	errDenied := errors.New("permission denied")
+	resolver := calcrat.ResolverFunc(func(ctx context.Context, name string) (*big.Rat, error) {
+		if name == "secret" {
+			return nil, errDenied
+		}
+		return big.NewRat(1, 1), nil
+	})
+
+	_, err := calcrat.CalcContext(context.Background(), "public + secret", resolver)
+	ASSERT(t, "resolver error should be wrapped", errors.Is(err, errDenied))
+	var re *calcrat.ResolveError
+	ASSERT(t, "error should be ResolveError", errors.As(err, &re))
+	EQUALS(t, "identifier should be reported", "secret", re.Name)
+	EQUALS(t, "message should contain the name", "could not resolve secret: permission denied", err.Error())
+
+	_, err = calcrat.CalcContext(context.Background(), "1 || secret", resolver)
+	OK(t, err)
+}
+
+func TestCalcContextStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	resolved := []string{}
+	resolver := calcrat.ResolverFunc(func(ctx context.Context, name string) (*big.Rat, error) {
+		resolved = append(resolved, name)
+		if name == "b" {
+			cancel()
+		}
+		return big.NewRat(1, 1), nil
+	})
+
+	_, err := calcrat.CalcContext(ctx, "a + b + c", resolver)
+	ASSERT(t, "cancellation should be reported", errors.Is(err, context.Canceled))
+	EQUALS(t, "evaluation should stop after cancellation", []string{"a", "b"}, resolved)
+
+	_, err = calcrat.CalcContext(ctx, "1 + 1", resolver)
+	ASSERT(t, "done context should not be evaluated", errors.Is(err, context.Canceled))
+}
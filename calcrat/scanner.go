@@ -0,0 +1,149 @@
+package calcrat
+
+import "strings"
+
+const punct = "-+*/%&|^~()<>!?:,="
+
+// operators of two characters, which take precedence over the operators of their first character
+var longOps = []string{"**", "<<", ">>", "//", "<=", ">=", "==", "!=", "&&", "||"}
+
+// token is a lexical token of formula with its byte offset
+type token struct {
+	text string
+	pos  int
+}
+
+// tokenize splits formula into tokens and drops white spaces around them.
+// Characters between operators and delimiters make a single token, so that "1 2" is reported as an invalid literal.
+func tokenize(formula string) []token {
+	tokens := []token{}
+	for i := 0; i < len(formula); {
+		if isSpace(formula[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		if isNumberStart(formula, i) {
+			i = scanNumber(formula, i)
+			// keep the rest of the operand in the token to report it as an invalid literal
+			if end := scanOperand(formula, i); strings.TrimSpace(formula[i:end]) != "" {
+				i = end
+			}
+		} else if op := longOp(formula[i:]); op != "" {
+			i += len(op)
+		} else if strings.IndexByte(punct, formula[i]) >= 0 {
+			i++
+		} else {
+			i = scanOperand(formula, i)
+		}
+		tokens = append(tokens, token{strings.TrimSpace(formula[start:i]), start})
+	}
+	return tokens
+}
+
+// scanOperand returns the offset of the next operator or delimiter from i
+func scanOperand(formula string, i int) int {
+	for i < len(formula) && strings.IndexByte(punct, formula[i]) < 0 {
+		i++
+	}
+	return i
+}
+
+func longOp(s string) string {
+	for _, op := range longOps {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isNumberStart(formula string, i int) bool {
+	if isDigit(formula[i]) {
+		return true
+	}
+	return formula[i] == '.' && i+1 < len(formula) && (isDigit(formula[i+1]) || formula[i+1] == '(')
+}
+
+// scanNumber returns the end offset of the numeric literal from i.
+// Numeric literals are Go style integers with base prefixes and underscores, decimals with optional exponent,
+// decimals with repeating digits in brackets such as 0.1(6), each of which can be followed by % meaning /100.
+func scanNumber(formula string, i int) int {
+	if formula[i] == '0' && i+1 < len(formula) && strings.IndexByte("bBoOxX", formula[i+1]) >= 0 {
+		i += 2
+		for i < len(formula) && (isAlnum(formula[i]) || formula[i] == '_') {
+			i++
+		}
+		return scanPercent(formula, i)
+	}
+
+	digits := func() {
+		for i < len(formula) && (isDigit(formula[i]) || formula[i] == '_') {
+			i++
+		}
+	}
+	digits()
+	if i < len(formula) && formula[i] == '.' {
+		i++
+		digits()
+		if end := scanRepeating(formula, i); end > i {
+			return scanPercent(formula, end)
+		}
+	}
+	if i < len(formula) && (formula[i] == 'e' || formula[i] == 'E') {
+		j := i + 1
+		if j < len(formula) && (formula[j] == '+' || formula[j] == '-') {
+			j++
+		}
+		if j < len(formula) && isDigit(formula[j]) {
+			i = j
+			digits()
+		}
+	}
+	return scanPercent(formula, i)
+}
+
+// scanRepeating returns the end offset of the repeating digits in brackets from i, or i if there are none
+func scanRepeating(formula string, i int) int {
+	if i >= len(formula) || formula[i] != '(' {
+		return i
+	}
+	j := i + 1
+	for j < len(formula) && isDigit(formula[j]) {
+		j++
+	}
+	if j == i+1 || j >= len(formula) || formula[j] != ')' {
+		return i
+	}
+	return j + 1
+}
+
+// scanPercent returns the offset after the % suffix at i if any.
+// % directly after a number is a percent sign unless an operand directly follows,
+// so that 15% + x is 0.15 + x while 7%2 is remainder.
+// % directly followed by a prefix operator or a bracket such as 15%-2 is left to the parser, which rejects it as ambiguous.
+func scanPercent(formula string, i int) int {
+	if i >= len(formula) || formula[i] != '%' {
+		return i
+	}
+	if i+1 < len(formula) {
+		c := formula[i+1]
+		if isAlnum(c) || c == '_' || c == '.' || strings.IndexByte("(+-~^!", c) >= 0 {
+			return i
+		}
+	}
+	return i + 1
+}
+
+func isSpace(c byte) bool {
+	return strings.IndexByte(" \t\n\v\f\r", c) >= 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
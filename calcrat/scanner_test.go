@@ -0,0 +1,118 @@
+package calcrat_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestNumericLiterals(t *testing.T) {
+	tests := []struct {
+		formula string
+		exp     string
+	}{
+		{"0b1010_0000", "160"},
+		{"0B11", "3"},
+		{"0o17", "15"},
+		{"017", "15"},
+		{"0xff_ff", "65535"},
+		{"1_000_000", "1000000"},
+		{"1_000.000_5", "2000001/2000"},
+		{"1e-3", "1/1000"},
+		{"1E+3", "1000"},
+		{"2.5e2", "250"},
+		{".5e1", "5"},
+		{"1e-3*1000", "1"},
+		{"2e3-1", "1999"},
+		{"15%", "3/20"},
+		{"200 * 15%", "30"},
+		{"15% + 1", "23/20"},
+		{"1.5e1%", "3/20"},
+		{"0x10%", "4/25"},
+		{"0.(3)%", "1/300"},
+		{"max(5%, 1%)", "1/20"},
+		{"(50%)", "1/2"},
+		{"7%2", "1"},
+		{"7 % 2", "1"},
+		{"7 %-2", "1"},
+		{"7 % (5)", "2"},
+		{"15% -2", "-37/20"},
+		{"15% +3", "63/20"},
+	}
+
+	for _, test := range tests {
+		v, err := calcrat.Calc(test.formula, nil, nil)
+		OK(t, err)
+		EQUALS(t, "literal should be parsed exactly: "+test.formula, test.exp, v.RatString())
+	}
+}
+
+func TestMalformedNumericLiterals(t *testing.T) {
+	tests := []struct {
+		formula string
+		offset  int
+		literal string
+	}{
+		{"1__000", 0, "1__000"},
+		{"1_", 0, "1_"},
+		{"1_.5", 0, "1_.5"},
+		{"0b102", 0, "0b102"},
+		{"1 + 2e", 4, "2e"},
+		{"1e-", 0, "1e"},
+		{"2x + 1", 0, "2x"},
+		{"1 2+3", 0, "1 2"},
+	}
+
+	for _, test := range tests {
+		_, err := calcrat.Compile(test.formula)
+		var le *calcrat.InvalidLiteralError
+		ASSERT(t, "error should be InvalidLiteralError: "+test.formula, errors.As(err, &le))
+		EQUALS(t, "offset should match: "+test.formula, test.offset, le.Offset)
+		EQUALS(t, "literal should match: "+test.formula, test.literal, le.Literal)
+	}
+}
+
+func TestAmbiguousPercentIsRejected(t *testing.T) {
+	tests := []struct {
+		formula string
+		offset  int
+	}{
+		{"15%+x", 2},
+		{"7%-2", 1},
+		{"1 + 7%(5)", 5},
+		{"0x10%~1", 4},
+		{"50%!x", 2},
+	}
+
+	for _, test := range tests {
+		_, err := calcrat.Parse(test.formula)
+		var se *calcrat.SyntaxError
+		ASSERT(t, "error should be SyntaxError: "+test.formula, errors.As(err, &se))
+		EQUALS(t, "offset should match: "+test.formula, test.offset, se.Offset)
+		EQUALS(t, "token should match: "+test.formula, "%", se.Token)
+	}
+}
+
+func TestFormatKeepsPercentLiterals(t *testing.T) {
+	tests := []struct {
+		formula string
+		exp     string
+	}{
+		{"15% - 2 == x", "15% - 2 == x"},
+		{"15%*x", "15% * x"},
+		{"1 + 7 %-2", "1 + 7 % -2"},
+		{"1 + x%2", "1 + x % 2"},
+	}
+
+	for _, test := range tests {
+		s, err := calcrat.Format(test.formula)
+		OK(t, err)
+		EQUALS(t, "percent literal should be formatted: "+test.formula, test.exp, s)
+
+		x, err := calcrat.Parse(s)
+		OK(t, err)
+		EQUALS(t, "formatted formula should be parsed back: "+test.formula, s, calcrat.FormatExpr(x))
+	}
+}
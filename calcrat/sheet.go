@@ -0,0 +1,241 @@
+package calcrat
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Sheet is a set of named formulas which can refer to each other by name.
+// Formulas are evaluated in the order of their dependencies.
+type Sheet struct {
+	names []string
+	cells map[string]*Expression
+}
+
+// NewSheet returns an empty Sheet
+func NewSheet() *Sheet {
+	return &Sheet{
+		names: []string{},
+		cells: map[string]*Expression{},
+	}
+}
+
+// Set compiles formula and sets it to the cell of given name, replacing existing one
+func (s *Sheet) Set(name, formula string) error {
+	e, err := Compile(formula)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.cells[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.cells[name] = e
+	return nil
+}
+
+// Delete removes the cell of given name
+func (s *Sheet) Delete(name string) {
+	if _, ok := s.cells[name]; !ok {
+		return
+	}
+	delete(s.cells, name)
+	for i, n := range s.names {
+		if n == name {
+			s.names = append(s.names[:i], s.names[i+1:]...)
+			return
+		}
+	}
+}
+
+// Order returns the names of cells in the order of evaluation.
+// CycleError is returned if cells refer to each other.
+func (s *Sheet) Order() ([]string, error) {
+	order, cycles := s.sort()
+	for _, name := range order {
+		if err, ok := cycles[name]; ok {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// dependencies returns the names of cells which the cell of given name refers to
+func (s *Sheet) dependencies(name string) []string {
+	deps := []string{}
+	for _, n := range s.cells[name].names {
+		if _, ok := s.cells[n]; ok {
+			deps = append(deps, n)
+		}
+	}
+	return deps
+}
+
+// sort sorts cells topologically in depth-first order.
+// Cells on cycles are also returned in the order with CycleError.
+// Strongly connected cells are found as in Tarjan's algorithm, so that each cell on a cycle gets a cycle through it.
+func (s *Sheet) sort() ([]string, map[string]*CycleError) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	order := []string{}
+	cycles := map[string]*CycleError{}
+	path := []string{}
+
+	// index is the order of visit and low is the smallest index reachable through cells on stack
+	index := map[string]int{}
+	low := map[string]int{}
+	stack := []string{}
+	onStack := map[string]bool{}
+	lower := func(name string, i int) {
+		if i < low[name] {
+			low[name] = i
+		}
+	}
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		path = append(path, name)
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, dep := range s.dependencies(name) {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+				lower(name, low[dep])
+			case visiting:
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] != dep {
+						continue
+					}
+					err := &CycleError{Path: append(append([]string{}, path[i:]...), dep)}
+					for _, n := range path[i:] {
+						if _, ok := cycles[n]; !ok {
+							cycles[n] = err
+						}
+					}
+					break
+				}
+				lower(name, index[dep])
+			default:
+				if onStack[dep] {
+					lower(name, index[dep])
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, name)
+
+		if low[name] != index[name] {
+			return
+		}
+		i := len(stack) - 1
+		for stack[i] != name {
+			i--
+		}
+		members := map[string]bool{}
+		for _, n := range stack[i:] {
+			members[n] = true
+			onStack[n] = false
+		}
+		// cells reaching a cycle only by cross edges are not on the path when the cycle is found
+		for _, n := range stack[i:] {
+			if _, ok := cycles[n]; !ok && len(members) > 1 {
+				cycles[n] = s.cycleThrough(n, members)
+			}
+		}
+		stack = stack[:i]
+	}
+
+	for _, name := range s.names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return order, cycles
+}
+
+// cycleThrough returns the shortest cycle from the cell of given name back to itself within members
+func (s *Sheet) cycleThrough(name string, members map[string]bool) *CycleError {
+	parent := map[string]string{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, dep := range s.dependencies(n) {
+			if dep == name {
+				reversed := []string{}
+				for c := n; c != name; c = parent[c] {
+					reversed = append(reversed, c)
+				}
+				path := []string{name}
+				for i := len(reversed) - 1; i >= 0; i-- {
+					path = append(path, reversed[i])
+				}
+				return &CycleError{Path: append(path, name)}
+			}
+			if _, ok := parent[dep]; !ok && members[dep] {
+				parent[dep] = n
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return &CycleError{Path: []string{name, name}}
+}
+
+// Eval evaluates all cells with given variables and returns the results by cell name.
+// See EvalFunctions for the details.
+func (s *Sheet) Eval(variables Variables, handler Handler) (Variables, map[string]error) {
+	return s.EvalFunctions(variables, nil, handler)
+}
+
+// EvalFunctions evaluates all cells with given variables and functions and returns the results by cell name.
+// Cells take precedence over variables of the same name.
+// Errors are returned by cell name. Cells on cycles get CycleError and
+// cells which depend on failed cells get an error wrapping the error of the dependency.
+func (s *Sheet) EvalFunctions(variables Variables, functions Functions, handler Handler) (Variables, map[string]error) {
+	order, cycles := s.sort()
+	results := Variables{}
+	errs := map[string]error{}
+
+	vars := make(Variables, len(variables)+len(order))
+	for k, v := range variables {
+		vars[k] = v
+	}
+
+	for _, name := range order {
+		if err, ok := cycles[name]; ok {
+			errs[name] = err
+			continue
+		}
+		if err := s.failedDependency(name, errs); err != nil {
+			errs[name] = err
+			continue
+		}
+
+		v, err := s.cells[name].EvalFunctions(vars, functions, handler)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		vars[name] = v
+		results[name] = new(big.Rat).Set(v)
+	}
+	return results, errs
+}
+
+// failedDependency returns an error if any dependency of the cell of given name has failed
+func (s *Sheet) failedDependency(name string, errs map[string]error) error {
+	for _, dep := range s.dependencies(name) {
+		if err, ok := errs[dep]; ok {
+			return fmt.Errorf("depends on failed cell %s: %w", dep, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestSheetEvaluatesCellsInDependencyOrder(t *testing.T) {
+	s := calcrat.NewSheet()
+	OK(t, s.Set("total", "subtotal + tax"))
+	OK(t, s.Set("tax", "subtotal * 0.08"))
+	OK(t, s.Set("subtotal", "a * b"))
+
+	order, err := s.Order()
+	OK(t, err)
+	EQUALS(t, "cells should be ordered by dependencies", []string{"subtotal", "tax", "total"}, order)
+
+	results, errs := s.Eval(calcrat.Variables{"a": big.NewRat(25, 1), "b": big.NewRat(4, 1)}, nil)
+	EQUALS(t, "no error should be returned", 0, len(errs))
+	EQUALS(t, "subtotal should be evaluated", "100", results["subtotal"].RatString())
+	EQUALS(t, "tax should be evaluated", "8", results["tax"].RatString())
+	EQUALS(t, "total should be evaluated", "108", results["total"].RatString())
+	_, ok := results["a"]
+	ASSERT(t, "variables should not be included in results", !ok)
+}
+
+func TestSheetReportsCycles(t *testing.T) {
+	s := calcrat.NewSheet()
+	OK(t, s.Set("a", "b + 1"))
+	OK(t, s.Set("b", "c * 2"))
+	OK(t, s.Set("c", "a - 1"))
+	OK(t, s.Set("d", "c + 1"))
+	OK(t, s.Set("e", "x + 1"))
+	OK(t, s.Set("f", "f"))
+
+	_, err := s.Order()
+	var ce *calcrat.CycleError
+	ASSERT(t, "error should be CycleError", errors.As(err, &ce))
+	EQUALS(t, "cycle path should be reported", []string{"a", "b", "c", "a"}, ce.Path)
+
+	results, errs := s.Eval(calcrat.Variables{"x": big.NewRat(1, 1)}, nil)
+	for _, name := range []string{"a", "b", "c"} {
+		ASSERT(t, "cell on cycle should have CycleError: "+name, errors.As(errs[name], &ce))
+		EQUALS(t, "cycle path should be reported", "cycle detected - a -> b -> c -> a", ce.Error())
+	}
+	ASSERT(t, "dependent of cycle should have CycleError", errors.As(errs["d"], &ce))
+	ASSERT(t, "self reference should have CycleError", errors.As(errs["f"], &ce))
+	EQUALS(t, "self reference path should be reported", []string{"f", "f"}, ce.Path)
+	EQUALS(t, "independent cell should be evaluated", "2", results["e"].RatString())
+}
+
+func TestSheetReportsCycleOfEachCell(t *testing.T) {
+	s := calcrat.NewSheet()
+	OK(t, s.Set("r", "y + x"))
+	OK(t, s.Set("y", "r * 2"))
+	OK(t, s.Set("x", "y - 1"))
+
+	_, errs := s.Eval(nil, nil)
+	var ce *calcrat.CycleError
+	for name, path := range map[string][]string{
+		"r": {"r", "y", "r"},
+		"y": {"r", "y", "r"},
+		"x": {"x", "y", "r", "x"},
+	} {
+		ASSERT(t, "cell on cycle should have CycleError: "+name, errors.As(errs[name], &ce))
+		EQUALS(t, "cycle through the cell should be reported: "+name, path, ce.Path)
+	}
+}
+
+func TestSheetReportsErrorsPerCell(t *testing.T) {
+	s := calcrat.NewSheet()
+	OK(t, s.Set("rate", "1/x"))
+	OK(t, s.Set("amount", "100 * rate"))
+	OK(t, s.Set("fee", "5"))
+
+	results, errs := s.Eval(calcrat.Variables{"x": big.NewRat(0, 1)}, nil)
+	ASSERT(t, "division by zero should be reported", errors.Is(errs["rate"], calcrat.ErrDivisionByZero))
+	ASSERT(t, "dependent should wrap the error", errors.Is(errs["amount"], calcrat.ErrDivisionByZero))
+	EQUALS(t, "other cell should be evaluated", "5", results["fee"].RatString())
+
+	OK(t, s.Set("rate", "2"))
+	s.Delete("fee")
+	results, errs = s.Eval(nil, nil)
+	EQUALS(t, "no error should be returned", 0, len(errs))
+	EQUALS(t, "replaced cell should be evaluated", "200", results["amount"].RatString())
+	EQUALS(t, "deleted cell should not be evaluated", 2, len(results))
+
+	ASSERT(t, "malformed formula should be rejected", s.Set("bad", "1 +") != nil)
+}
@@ -0,0 +1,230 @@
+package calcrat
+
+import (
+	"context"
+	"math/big"
+)
+
+// Simplify substitutes given variables into formula, folds constant sub-expressions
+// and applies the identities x+0, x-0, 0-x, x*1, x*0, x/1, x**1 and x**0.
+// Identifiers not found in variables or whose values are nil are left as they are, so that the result can be evaluated later.
+// Function calls are not folded since functions can be given on evaluation, but if() with constant condition is.
+// Note that x*0 is folded to 0 even if x cannot be evaluated.
+func Simplify(formula string, variables Variables) (*Expression, error) {
+	e, err := Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	return e.Simplify(variables)
+}
+
+// Simplify returns a simplified copy of the expression. See Simplify for the details.
+// Constant sub-expressions are folded with the options and limits of the expression,
+// so that those which would fail on evaluation are left as they are.
+func (e *Expression) Simplify(variables Variables) (*Expression, error) {
+	f := &folder{
+		variables: variables,
+		scope: &scope{
+			ctx:          context.Background(),
+			resolver:     Variables{},
+			divZero:      e.divZero,
+			approxPow:    e.approxPow,
+			maxPowerBits: e.maxPowerBits,
+			limits:       e.limits,
+		},
+	}
+	x, _ := f.simplify(e.ast)
+	s, err := CompileLimits(FormatExpr(x), e.limits)
+	if err != nil {
+		return nil, err
+	}
+	s.divZero = e.divZero
+	s.approxPow = e.approxPow
+	s.maxPowerBits = e.maxPowerBits
+	return s, nil
+}
+
+// folder substitutes variables and folds constant sub-expressions within the settings of scope
+type folder struct {
+	variables Variables
+	scope     *scope
+}
+
+// simplify returns the simplified x and its value if it is constant
+func (f *folder) simplify(x Expr) (Expr, *big.Rat) {
+	switch x := x.(type) {
+	case *NumberLit:
+		if v, ok := parseNumber(x.Value); ok {
+			return x, f.constant(v)
+		}
+		return x, nil
+	case *Ident:
+		if v := f.variables[x.Name]; v != nil {
+			return ratExpr(v), f.constant(v)
+		}
+		return x, nil
+	case *Paren:
+		return f.simplify(x.X)
+	case *UnaryExpr:
+		operand, v := f.simplify(x.X)
+		if x.Op == "+" {
+			return operand, v
+		}
+		if fn, ok := prefixOps[x.Op]; ok && v != nil {
+			op := fn()
+			op.setRight(&literal{v: v})
+			if v := f.eval(op); v != nil {
+				return ratExpr(v), v
+			}
+		}
+		return &UnaryExpr{Op: x.Op, X: operand}, nil
+	case *BinaryExpr:
+		left, lv := f.simplify(x.X)
+		right, rv := f.simplify(x.Y)
+		return f.simplifyBinary(&BinaryExpr{X: left, Op: x.Op, Y: right}, lv, rv)
+	case *Call:
+		args := make([]Expr, len(x.Args))
+		vals := make([]*big.Rat, len(x.Args))
+		for i, arg := range x.Args {
+			args[i], vals[i] = f.simplify(arg)
+		}
+		if x.Fun.Name == "if" && len(args) == 3 && vals[0] != nil {
+			return pick(vals[0], args[1], vals[1], args[2], vals[2])
+		}
+		return &Call{Fun: &Ident{Name: x.Fun.Name}, Args: args}, nil
+	case *CondExpr:
+		c, cv := f.simplify(x.Cond)
+		then, tv := f.simplify(x.Then)
+		els, ev := f.simplify(x.Else)
+		if cv != nil {
+			return pick(cv, then, tv, els, ev)
+		}
+		return &CondExpr{Cond: c, Then: then, Else: els}, nil
+	}
+	return x, nil
+}
+
+func pick(cond *big.Rat, then Expr, tv *big.Rat, els Expr, ev *big.Rat) (Expr, *big.Rat) {
+	if cond.Sign() != 0 {
+		return then, tv
+	}
+	return els, ev
+}
+
+func (f *folder) simplifyBinary(x *BinaryExpr, left, right *big.Rat) (Expr, *big.Rat) {
+	if left != nil && right != nil {
+		if b, ok := binaryOps[x.Op]; ok {
+			op := b.new()
+			op.setLeft(&literal{v: left})
+			op.setRight(&literal{v: right})
+			if v := f.eval(op); v != nil {
+				return ratExpr(v), v
+			}
+		}
+		// x is left as it is if it cannot be evaluated, so that the error is reported on evaluation
+		return x, nil
+	}
+
+	is := func(v *big.Rat, i int64) bool {
+		return v != nil && v.Cmp(big.NewRat(i, 1)) == 0
+	}
+
+	switch x.Op {
+	case "+":
+		if is(left, 0) {
+			return x.Y, nil
+		}
+		if is(right, 0) {
+			return x.X, nil
+		}
+	case "-":
+		if is(right, 0) {
+			return x.X, nil
+		}
+		if is(left, 0) {
+			return &UnaryExpr{Op: "-", X: x.Y}, nil
+		}
+	case "*":
+		if is(left, 0) || is(right, 0) {
+			return ratExpr(new(big.Rat)), new(big.Rat)
+		}
+		if is(left, 1) {
+			return x.Y, nil
+		}
+		if is(right, 1) {
+			return x.X, nil
+		}
+	case "/":
+		if is(right, 1) {
+			return x.X, nil
+		}
+	case "**":
+		if is(right, 1) {
+			return x.X, nil
+		}
+		if is(right, 0) {
+			return ratExpr(big.NewRat(1, 1)), big.NewRat(1, 1)
+		}
+	}
+	return x, nil
+}
+
+// eval returns the value of n whose operands are literals, or nil if n fails within the settings of scope
+func (f *folder) eval(n node) *big.Rat {
+	v, err := n.val(f.scope)
+	if err != nil {
+		return nil
+	}
+	return f.constant(v)
+}
+
+// constant returns v, or nil if v exceeds MaxBits so that it is not folded
+func (f *folder) constant(v *big.Rat) *big.Rat {
+	if max := f.scope.limits.MaxBits; max > 0 && (v.Num().BitLen() > max || v.Denom().BitLen() > max) {
+		return nil
+	}
+	return v
+}
+
+// ratExpr returns the expression of r.
+// r is written as decimal if it has finite decimal representation, otherwise as a fraction.
+func ratExpr(r *big.Rat) Expr {
+	if r.Sign() < 0 {
+		return &UnaryExpr{Op: "-", X: ratExpr(new(big.Rat).Neg(r))}
+	}
+	if r.IsInt() {
+		return &NumberLit{Value: r.Num().String()}
+	}
+	if digits, ok := decimalDigits(r.Denom()); ok {
+		return &NumberLit{Value: r.FloatString(digits)}
+	}
+	return &BinaryExpr{X: &NumberLit{Value: r.Num().String()}, Op: "/", Y: &NumberLit{Value: r.Denom().String()}}
+}
+
+// decimalDigits returns the number of decimal places of 1/denom if it is finite
+func decimalDigits(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	twos := removeFactor(d, 2)
+	fives := removeFactor(d, 5)
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+// removeFactor divides d by p as long as it is divisible and returns the number of divisions
+func removeFactor(d *big.Int, p int64) int {
+	n := 0
+	q, r := new(big.Int), new(big.Int)
+	for {
+		q.QuoRem(d, big.NewInt(p), r)
+		if r.Sign() != 0 {
+			return n
+		}
+		d.Set(q)
+		n++
+	}
+}
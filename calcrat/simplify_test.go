@@ -0,0 +1,107 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestSimplifySubstitutesAndFolds(t *testing.T) {
+	vars := calcrat.Variables{
+		"rate":  big.NewRat(8, 100),
+		"zero":  big.NewRat(0, 1),
+		"one":   big.NewRat(1, 1),
+		"third": big.NewRat(1, 3),
+		"neg":   big.NewRat(-2, 1),
+	}
+
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"price * (1 + rate)", "price * 1.08"},
+		{"price * (1 + rate) * quantity", "price * 1.08 * quantity"},
+		{"(2 + 3) * x", "5 * x"},
+		{"x * one", "x"},
+		{"one * x", "x"},
+		{"x + zero", "x"},
+		{"zero + x", "x"},
+		{"x - zero", "x"},
+		{"zero - x", "-x"},
+		{"x * zero + y", "y"},
+		{"x / one", "x"},
+		{"x ** one", "x"},
+		{"x ** zero", "1"},
+		{"x * third", "x * (1 / 3)"},
+		{"x + neg", "x + -2"},
+		{"neg ** x", "(-2) ** x"},
+		{"rate > 0 ? price * rate : price", "price * 0.08"},
+		{"if(zero, a, b)", "b"},
+		{"max(x, 1 + 1)", "max(x, 2)"},
+		{"max(1, 2) + x", "max(1, 2) + x"},
+		{"x + 1/zero", "x + 1/0"},
+		{"+x", "x"},
+	}
+
+	for _, c := range cases {
+		actual, err := calcrat.Simplify(c.formula, vars)
+		OK(t, err)
+		EQUALS(t, "formula should be simplified: "+c.formula, c.expected, actual.String())
+	}
+}
+
+func TestSimplifiedExpressionCanBeFinishedLater(t *testing.T) {
+	formula := "(price * quantity - discount) * (100 + tax) / 100"
+	partial, err := calcrat.Simplify(formula, calcrat.Variables{"tax": big.NewRat(8, 1), "discount": big.NewRat(0, 1)})
+	OK(t, err)
+	EQUALS(t, "partial expression should be reduced", "price * quantity * 108 / 100", partial.String())
+	EQUALS(t, "remaining variables should be listed", []string{"price", "quantity"}, partial.VariableNames())
+
+	rest := calcrat.Variables{"price": big.NewRat(1999, 100), "quantity": big.NewRat(3, 1)}
+	expected, err := calcrat.Calc(formula, calcrat.Variables{"tax": big.NewRat(8, 1), "discount": big.NewRat(0, 1), "price": rest["price"], "quantity": rest["quantity"]}, nil)
+	OK(t, err)
+	actual, err := partial.Eval(rest, nil)
+	OK(t, err)
+	EQUALS(t, "simplified expression should be evaluated to the same value", expected.RatString(), actual.RatString())
+}
+
+func TestSimplifyReturnsSyntaxError(t *testing.T) {
+	_, err := calcrat.Simplify("1 +", nil)
+	ASSERT(t, "error should not be nil", err != nil)
+}
+
+func TestSimplifyLeavesNilVariables(t *testing.T) {
+	s, err := calcrat.Simplify("x + y * 2", calcrat.Variables{"x": nil, "y": big.NewRat(3, 1)})
+	OK(t, err)
+	EQUALS(t, "nil variable should be left", "x + 6", s.String())
+
+	_, err = s.Eval(calcrat.Variables{"x": nil}, nil)
+	var re *calcrat.ResolveError
+	ASSERT(t, "nil variable should fail on evaluation", errors.As(err, &re))
+}
+
+func TestSimplifyFoldsWithinOptionsAndLimits(t *testing.T) {
+	e, err := calcrat.CompileLimits("x + 2**1000 + 2**3", calcrat.Limits{MaxBits: 64})
+	OK(t, err)
+	s, err := e.Simplify(nil)
+	OK(t, err)
+	EQUALS(t, "value exceeding MaxBits should not be folded", "x + 2**1000 + 8", s.String())
+
+	e, err = calcrat.Compile("2**100 + x")
+	OK(t, err)
+	e = e.WithMaxPowerBits(64)
+	s, err = e.Simplify(nil)
+	OK(t, err)
+	EQUALS(t, "power exceeding max power bits should not be folded", "2**100 + x", s.String())
+	_, err = s.Eval(calcrat.Variables{"x": big.NewRat(1, 1)}, nil)
+	ASSERT(t, "simplified expression should fail like the source", errors.Is(err, calcrat.ErrPowerTooLarge))
+
+	e, err = calcrat.Compile("x + 1/0")
+	OK(t, err)
+	s, err = e.WithDivisionByZero(big.NewRat(0, 1)).Simplify(nil)
+	OK(t, err)
+	EQUALS(t, "division by zero should be folded to fallback", "x", s.String())
+}
@@ -0,0 +1,429 @@
+package calcrat
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Dimension is the exponents of the SI base units m, kg, s, A, K, mol and cd
+type Dimension [7]int
+
+var baseUnits = [7]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+
+func (d Dimension) mul(e Dimension, sign int) Dimension {
+	for i := range d {
+		d[i] += sign * e[i]
+	}
+	return d
+}
+
+// IsDimensionless reports whether all exponents are zero
+func (d Dimension) IsDimensionless() bool {
+	return d == Dimension{}
+}
+
+// String returns the dimension in base units such as kg*m/s**2
+func (d Dimension) String() string {
+	num, denom := []string{}, []string{}
+	for i, e := range d {
+		unit := baseUnits[i]
+		if e > 1 || e < -1 {
+			unit = fmt.Sprintf("%s**%d", unit, abs64(int64(e)))
+		}
+		if e > 0 {
+			num = append(num, unit)
+		} else if e < 0 {
+			denom = append(denom, unit)
+		}
+	}
+	s := strings.Join(num, "*")
+	if s == "" {
+		s = "1"
+	}
+	if len(denom) > 1 {
+		return s + "/(" + strings.Join(denom, "*") + ")"
+	}
+	if len(denom) == 1 {
+		return s + "/" + denom[0]
+	}
+	return s
+}
+
+// Quantity is a value with a dimension. Value is in the coherent SI unit of the dimension.
+type Quantity struct {
+	Value *big.Rat
+	Dim   Dimension
+}
+
+// String returns the value followed by the dimension in base units such as 3/2 m/s
+func (q Quantity) String() string {
+	if q.Value == nil {
+		return "<nil>"
+	}
+	if q.Dim.IsDimensionless() {
+		return q.Value.RatString()
+	}
+	return q.Value.RatString() + " " + q.Dim.String()
+}
+
+// Quantities is a set of named quantities.
+// It is separate from Variables, whose values are rationals for Calc and Expression,
+// so that existing users of Variables are not affected. Variables.Quantities converts Variables into Quantities.
+type Quantities map[string]Quantity
+
+// Quantities returns the variables as dimensionless quantities, so that they can be mixed with quantities
+func (v Variables) Quantities() Quantities {
+	q := make(Quantities, len(v))
+	for name, r := range v {
+		q[name] = Quantity{r, Dimension{}}
+	}
+	return q
+}
+
+// unit is a unit of measurement defined as factor times the coherent SI unit of the dimension.
+// prefixed is set for units such as kg whose names already have an SI prefix, which cannot take another one.
+type unit struct {
+	factor   *big.Rat
+	dim      Dimension
+	prefixed bool
+}
+
+// prefixes are SI prefixes which can be put to any unit name, ordered so that da is tried before d
+var prefixes = []struct {
+	name   string
+	factor *big.Rat
+}{
+	{"da", big.NewRat(10, 1)},
+	{"P", big.NewRat(1000000000000000, 1)},
+	{"T", big.NewRat(1000000000000, 1)},
+	{"G", big.NewRat(1000000000, 1)},
+	{"M", big.NewRat(1000000, 1)},
+	{"k", big.NewRat(1000, 1)},
+	{"h", big.NewRat(100, 1)},
+	{"d", big.NewRat(1, 10)},
+	{"c", big.NewRat(1, 100)},
+	{"m", big.NewRat(1, 1000)},
+	{"µ", big.NewRat(1, 1000000)},
+	{"u", big.NewRat(1, 1000000)},
+	{"n", big.NewRat(1, 1000000000)},
+	{"p", big.NewRat(1, 1000000000000)},
+}
+
+// Units is a registry of units which evaluates formulas with quantities.
+// Units is not safe for concurrent use while units are being defined.
+type Units struct {
+	units map[string]unit
+}
+
+// NewUnits returns Units with the SI base units, the SI derived units N, J, W, Pa, Hz, C and V,
+// and g, min, h, Wh and L. Any unit can be used with SI prefixes such as km or kWh.
+func NewUnits() *Units {
+	u := &Units{units: map[string]unit{}}
+	for i, name := range baseUnits {
+		var d Dimension
+		d[i] = 1
+		u.units[name] = unit{big.NewRat(1, 1), d, name == "kg"}
+	}
+
+	for _, def := range [][2]string{
+		{"g", "kg / 1000"},
+		{"N", "kg * m / s**2"},
+		{"J", "N * m"},
+		{"W", "J / s"},
+		{"Pa", "N / m**2"},
+		{"Hz", "1 / s"},
+		{"C", "A * s"},
+		{"V", "W / A"},
+		{"min", "60 s"},
+		{"h", "60 min"},
+		{"Wh", "W * h"},
+		{"L", "m**3 / 1000"},
+	} {
+		if err := u.Define(def[0], def[1]); err != nil {
+			panic(err)
+		}
+	}
+	return u
+}
+
+// Define defines the unit of given name by a formula of other units such as "1000 * W * h" or "60 s".
+// Existing unit of the same name is replaced.
+func (u *Units) Define(name, definition string) error {
+	if !isUnitName(name) {
+		return fmt.Errorf("invalid unit name %q", name)
+	}
+	q, err := u.Calc(definition, nil)
+	if err != nil {
+		return err
+	}
+	if q.Value.Sign() <= 0 {
+		return fmt.Errorf("unit %s must be positive - %s", name, definition)
+	}
+	u.units[name] = unit{q.Value, q.Dim, false}
+	return nil
+}
+
+// lookup returns the unit of given name which may have an SI prefix
+func (u *Units) lookup(name string) (unit, bool) {
+	if un, ok := u.units[name]; ok {
+		return un, true
+	}
+	for _, p := range prefixes {
+		if !strings.HasPrefix(name, p.name) {
+			continue
+		}
+		if un, ok := u.units[name[len(p.name):]]; ok && !un.prefixed {
+			return unit{new(big.Rat).Mul(p.factor, un.factor), un.dim, true}, true
+		}
+	}
+	return unit{}, false
+}
+
+// Quantity returns the quantity of v in given unit, which can be a formula of units such as m/s
+func (u *Units) Quantity(v *big.Rat, unit string) (Quantity, error) {
+	q, err := u.Calc(unit, nil)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{q.Value.Mul(q.Value, v), q.Dim}, nil
+}
+
+// Convert returns the value of q in given unit, which can be a formula of units such as km/h.
+// DimensionError is returned if the dimensions differ.
+func (u *Units) Convert(q Quantity, unit string) (*big.Rat, error) {
+	to, err := u.Calc(unit, nil)
+	if err != nil {
+		return nil, err
+	}
+	if q.Value == nil {
+		return nil, fmt.Errorf("invalid quantity - %s", q)
+	}
+	if to.Dim != q.Dim {
+		return nil, &DimensionError{Expr: unit, Left: q.Dim, Right: to.Dim}
+	}
+	return to.Value.Quo(q.Value, to.Value), nil
+}
+
+// Calc returns the quantity calculated from given formula with given quantities.
+// Identifiers are resolved from quantities first and then from units, and numeric literals can be followed by
+// a unit such as 3 m or 1500 g. A unit literal cannot be raised to a power, so that 3 m**2 is rejected as ambiguous:
+// write 3 * m**2 or (3 m)**2.
+// + and - and comparisons require the same dimension, while * and / combine dimensions and
+// ** requires an integer exponent for quantities with dimension. min, max and abs keep the dimension.
+// Other operators and functions accept only dimensionless quantities.
+// An error is returned if any of quantities has nil Value.
+func (u *Units) Calc(formula string, quantities Quantities) (Quantity, error) {
+	for name, q := range quantities {
+		if q.Value == nil {
+			return Quantity{}, fmt.Errorf("invalid quantity of %s - nil", name)
+		}
+	}
+	x, err := Parse(formula)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return u.eval(formula, x, quantities)
+}
+
+func (u *Units) eval(formula string, x Expr, quantities Quantities) (Quantity, error) {
+	switch x := x.(type) {
+	case *NumberLit:
+		v, _ := parseNumber(x.Value)
+		return Quantity{v, Dimension{}}, nil
+	case *UnitLit:
+		un, ok := u.lookup(x.Unit)
+		if !ok {
+			return Quantity{}, &UnknownUnitError{Name: x.Unit}
+		}
+		v, _ := parseNumber(x.Number.Value)
+		return Quantity{v.Mul(v, un.factor), un.dim}, nil
+	case *Ident:
+		if q, ok := quantities[x.Name]; ok {
+			return Quantity{new(big.Rat).Set(q.Value), q.Dim}, nil
+		}
+		if un, ok := u.lookup(x.Name); ok {
+			return Quantity{new(big.Rat).Set(un.factor), un.dim}, nil
+		}
+		return Quantity{}, &UnknownIdentifierError{Name: x.Name}
+	case *Paren:
+		return u.eval(formula, x.X, quantities)
+	case *UnaryExpr:
+		q, err := u.eval(formula, x.X, quantities)
+		if err != nil {
+			return Quantity{}, err
+		}
+		switch x.Op {
+		case "+":
+			return q, nil
+		case "-":
+			return Quantity{q.Value.Neg(q.Value), q.Dim}, nil
+		}
+		if !q.Dim.IsDimensionless() {
+			return Quantity{}, &DimensionError{Expr: formula[x.Pos():x.End()], Left: q.Dim}
+		}
+		return u.scalar(formula, x, []*big.Rat{q.Value})
+	case *BinaryExpr:
+		return u.evalBinary(formula, x, quantities)
+	case *Call:
+		if x.Fun.Name == "if" && len(x.Args) == 3 {
+			return u.evalCond(formula, x.Args[0], x.Args[1], x.Args[2], quantities)
+		}
+		return u.evalCall(formula, x, quantities)
+	case *CondExpr:
+		return u.evalCond(formula, x.Cond, x.Then, x.Else, quantities)
+	}
+	return Quantity{}, fmt.Errorf("unknown expression %T", x)
+}
+
+func (u *Units) evalBinary(formula string, x *BinaryExpr, quantities Quantities) (Quantity, error) {
+	l, err := u.eval(formula, x.X, quantities)
+	if err != nil {
+		return Quantity{}, err
+	}
+	// operands of logical operators are evaluated as truth values of any dimension
+	if (x.Op == "&&" && l.Value.Sign() == 0) || (x.Op == "||" && l.Value.Sign() != 0) {
+		return Quantity{truth(x.Op == "||"), Dimension{}}, nil
+	}
+	r, err := u.eval(formula, x.Y, quantities)
+	if err != nil {
+		return Quantity{}, err
+	}
+	mismatch := &DimensionError{Expr: formula[x.Pos():x.End()], Left: l.Dim, Right: r.Dim}
+
+	dim := Dimension{}
+	switch x.Op {
+	case "&&", "||":
+		return Quantity{truth(r.Value.Sign() != 0), Dimension{}}, nil
+	case "+", "-", "%", "//":
+		if l.Dim != r.Dim {
+			return Quantity{}, mismatch
+		}
+		if x.Op != "//" {
+			dim = l.Dim
+		}
+	case "==", "!=", "<", "<=", ">", ">=":
+		if l.Dim != r.Dim {
+			return Quantity{}, mismatch
+		}
+	case "*":
+		return Quantity{l.Value.Mul(l.Value, r.Value), l.Dim.mul(r.Dim, 1)}, nil
+	case "/":
+		if r.Value.Sign() == 0 {
+			return Quantity{}, &DivisionByZeroError{Expr: formula[x.Y.Pos():x.Y.End()]}
+		}
+		return Quantity{l.Value.Quo(l.Value, r.Value), l.Dim.mul(r.Dim, -1)}, nil
+	case "**":
+		if !r.Dim.IsDimensionless() {
+			return Quantity{}, mismatch
+		}
+		if !l.Dim.IsDimensionless() {
+			if !r.Value.IsInt() || !r.Value.Num().IsInt64() {
+				return Quantity{}, fmt.Errorf("%w - %s", ErrNonIntegerExponent, formula[x.Y.Pos():x.Y.End()])
+			}
+			n := int(r.Value.Num().Int64())
+			for i := range dim {
+				dim[i] = l.Dim[i] * n
+			}
+		}
+	default:
+		if !l.Dim.IsDimensionless() || !r.Dim.IsDimensionless() {
+			return Quantity{}, mismatch
+		}
+	}
+
+	q, err := u.scalar(formula, x, []*big.Rat{l.Value, r.Value})
+	if err != nil {
+		return Quantity{}, err
+	}
+	q.Dim = dim
+	return q, nil
+}
+
+func (u *Units) evalCall(formula string, x *Call, quantities Quantities) (Quantity, error) {
+	args := make([]*big.Rat, len(x.Args))
+	dim := Dimension{}
+	for i, arg := range x.Args {
+		q, err := u.eval(formula, arg, quantities)
+		if err != nil {
+			return Quantity{}, err
+		}
+		args[i] = q.Value
+		if i == 0 {
+			dim = q.Dim
+		}
+		if q.Dim != dim {
+			return Quantity{}, &DimensionError{Expr: formula[x.Pos():x.End()], Left: dim, Right: q.Dim}
+		}
+	}
+	switch x.Fun.Name {
+	case "min", "max", "abs":
+	default:
+		if !dim.IsDimensionless() {
+			return Quantity{}, &DimensionError{Expr: formula[x.Pos():x.End()], Left: dim}
+		}
+	}
+	q, err := u.scalar(formula, x, args)
+	if err != nil {
+		return Quantity{}, err
+	}
+	q.Dim = dim
+	return q, nil
+}
+
+func (u *Units) evalCond(formula string, cond, then, els Expr, quantities Quantities) (Quantity, error) {
+	c, err := u.eval(formula, cond, quantities)
+	if err != nil {
+		return Quantity{}, err
+	}
+	if c.Value.Sign() != 0 {
+		return u.eval(formula, then, quantities)
+	}
+	return u.eval(formula, els, quantities)
+}
+
+// scalar evaluates operator or function x with the values of operands by the evaluator for rationals
+func (u *Units) scalar(formula string, x Expr, operands []*big.Rat) (Quantity, error) {
+	s := &scope{
+		formula:      formula,
+		ctx:          context.Background(),
+		resolver:     Variables{},
+		maxPowerBits: DefaultMaxPowerBits,
+	}
+	var exprs []Expr
+	switch x := x.(type) {
+	case *UnaryExpr:
+		exprs = []Expr{x.X}
+	case *BinaryExpr:
+		exprs = []Expr{x.X, x.Y}
+	case *Call:
+		exprs = x.Args
+	}
+	// the literals are placed at their operands, so that errors describe the part of the formula
+	args := make([]node, len(operands))
+	for i, v := range operands {
+		args[i] = &literal{v: v, pos: exprs[i].Pos(), end: exprs[i].End()}
+	}
+
+	var n node
+	switch x := x.(type) {
+	case *UnaryExpr:
+		op := prefixOps[x.Op]()
+		op.setPos(x.OpPos)
+		op.setRight(args[0])
+		n = op
+	case *BinaryExpr:
+		op := binaryOps[x.Op].new()
+		op.setLeft(args[0])
+		op.setRight(args[1])
+		n = op
+	case *Call:
+		n = &call{x.Fun.Name, x.Fun.NamePos, args, x.Rparen}
+	}
+	v, err := n.val(s)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{new(big.Rat).Set(v), Dimension{}}, nil
+}
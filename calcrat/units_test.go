@@ -0,0 +1,149 @@
+package calcrat_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestUnitsConvertQuantities(t *testing.T) {
+	u := calcrat.NewUnits()
+	tests := []struct {
+		formula string
+		unit    string
+		exp     string
+	}{
+		{"1500 g + 2 kg", "kg", "7/2"},
+		{"1500 g + 2 kg", "g", "3500"},
+		{"90 km / (45 min)", "km/h", "120"},
+		{"2 kW * 30 min", "kWh", "1"},
+		{"1 kWh", "J", "3600000"},
+		{"3 m * 4 m", "m**2", "12"},
+		{"(3 m)**2 / 9", "m**2", "1"},
+		{"10 N / 2 kg", "m/s**2", "5"},
+		{"max(1 km, 900 m) - 1 m", "m", "999"},
+		{"2 L > 1500 mL ? 1 h : 1 s", "s", "3600"},
+		{"12 kg * 9.81 m/s**2", "N", "2943/25"},
+		{"20% * 1 km", "m", "200"},
+	}
+
+	for _, test := range tests {
+		q, err := u.Calc(test.formula, nil)
+		OK(t, err)
+		v, err := u.Convert(q, test.unit)
+		OK(t, err)
+		EQUALS(t, "quantity should be converted: "+test.formula+" in "+test.unit, test.exp, v.RatString())
+	}
+}
+
+func TestUnitsRejectDimensionMismatch(t *testing.T) {
+	u := calcrat.NewUnits()
+	for _, formula := range []string{"3 m + 2 s", "1 kg < 1 m", "2 ** (1 s)", "floor(1.5 m)", "min(1 m, 1 s)", "(2 m) % 3"} {
+		_, err := u.Calc(formula, nil)
+		var de *calcrat.DimensionError
+		ASSERT(t, "error should be DimensionError: "+formula, errors.As(err, &de))
+	}
+
+	_, err := u.Calc("3 m + 2 s", nil)
+	EQUALS(t, "message should describe dimensions", "dimension mismatch - 3 m + 2 s: m and s", err.Error())
+
+	q, err := u.Calc("1 m", nil)
+	OK(t, err)
+	_, err = u.Convert(q, "s")
+	var de *calcrat.DimensionError
+	ASSERT(t, "conversion should check dimension", errors.As(err, &de))
+
+	_, err = u.Calc("3 parsec", nil)
+	var ue *calcrat.UnknownUnitError
+	ASSERT(t, "unknown unit should be reported", errors.As(err, &ue))
+	EQUALS(t, "unit name should be reported", "parsec", ue.Name)
+
+	_, err = calcrat.Calc("3 m", nil, nil)
+	var le *calcrat.InvalidLiteralError
+	ASSERT(t, "plain evaluation should reject unit literals", errors.As(err, &le))
+	EQUALS(t, "unit literal should be reported", "3 m", le.Literal)
+}
+
+func TestUnitsRejectPowerOfUnitLiteral(t *testing.T) {
+	u := calcrat.NewUnits()
+	_, err := u.Calc("3 m**2", nil)
+	var se *calcrat.SyntaxError
+	ASSERT(t, "power of unit literal should be rejected", errors.As(err, &se))
+	EQUALS(t, "offset should match", 3, se.Offset)
+
+	q, err := u.Calc("3 * m**2", nil)
+	OK(t, err)
+	EQUALS(t, "power of unit should be evaluated", "3 m**2", q.String())
+
+	q, err = u.Calc("(3 m)**2", nil)
+	OK(t, err)
+	EQUALS(t, "power of quantity should be evaluated", "9 m**2", q.String())
+
+	tests := []struct {
+		formula string
+		exp     string
+	}{
+		{"(3 m) ** 2", "(3 m) ** 2"},
+		{"-(3 m) ** 2", "-(3 m) ** 2"},
+		{"(2 m) ** (1/2)", "(2 m) ** (1 / 2)"},
+		{"2 ** (3 m) * (3 m)", "2**3 m * 3 m"},
+	}
+	for _, test := range tests {
+		s, err := calcrat.Format(test.formula)
+		OK(t, err)
+		EQUALS(t, "power of unit literal should be bracketed: "+test.formula, test.exp, s)
+
+		x, err := calcrat.Parse(s)
+		OK(t, err)
+		EQUALS(t, "formatted formula should be parsed back: "+test.formula, s, calcrat.FormatExpr(x))
+	}
+}
+
+func TestUnitsDescribeErrors(t *testing.T) {
+	u := calcrat.NewUnits()
+	_, err := u.Calc("1 m % 30 cm", nil)
+	ASSERT(t, "non-integer operand should be rejected", errors.Is(err, calcrat.ErrNonIntegerOperand))
+	EQUALS(t, "operand should be reported", "non-integer operand - 30 cm", err.Error())
+
+	_, err = u.Calc("1 kkg", nil)
+	var ue *calcrat.UnknownUnitError
+	ASSERT(t, "prefix should not be put to kg", errors.As(err, &ue))
+	q, err := u.Calc("1 Mg", nil)
+	OK(t, err)
+	EQUALS(t, "prefix should be put to g", "1000 kg", q.String())
+
+	EQUALS(t, "zero quantity should be printed", "<nil>", calcrat.Quantity{}.String())
+	_, err = u.Convert(calcrat.Quantity{}, "m")
+	ASSERT(t, "zero quantity should not be converted", err != nil)
+
+	_, err = u.Calc("x + 1", calcrat.Variables{"x": nil}.Quantities())
+	ASSERT(t, "nil quantity should be rejected", err != nil)
+}
+
+func TestUnitsWithUserDefinedUnitsAndQuantities(t *testing.T) {
+	u := calcrat.NewUnits()
+	OK(t, u.Define("mi", "1609.344 m"))
+	OK(t, u.Define("mph", "mi / h"))
+
+	speed, err := u.Quantity(big.NewRat(60, 1), "mph")
+	OK(t, err)
+	EQUALS(t, "quantity should be in SI units", "16764/625 m/s", speed.String())
+
+	q, err := u.Calc("speed * duration", calcrat.Quantities{
+		"speed":    speed,
+		"duration": {Value: big.NewRat(1800, 1), Dim: calcrat.Dimension{2: 1}},
+	})
+	OK(t, err)
+	v, err := u.Convert(q, "mi")
+	OK(t, err)
+	EQUALS(t, "distance should be converted", "30", v.RatString())
+
+	q, err = u.Calc("price * 2 kg", calcrat.Variables{"price": big.NewRat(3, 1)}.Quantities())
+	OK(t, err)
+	EQUALS(t, "variables should be dimensionless", "6 kg", q.String())
+
+	ASSERT(t, "invalid definition should be rejected", u.Define("bad", "1 m + 1 s") != nil)
+}
@@ -1,5 +1,16 @@
 package calcrat
 
-import "math/big"
+import (
+	"context"
+	"math/big"
+)
 
 type Variables map[string]*big.Rat
+
+// Resolve returns the value of given name in the variables
+func (v Variables) Resolve(ctx context.Context, name string) (*big.Rat, error) {
+	if r, ok := v[name]; ok {
+		return r, nil
+	}
+	return nil, &UnknownIdentifierError{Name: name}
+}
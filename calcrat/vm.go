@@ -0,0 +1,489 @@
+package calcrat
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// opcode is the operation of an instruction of Program
+type opcode uint8
+
+const (
+	opConst     opcode = iota // vals[dst] = consts[a]
+	opLoad                    // vals[dst] = value of names[a]
+	opNeg                     // vals[dst] = -vals[dst]
+	opAdd                     // vals[dst] = vals[dst] + vals[dst+1]
+	opSub                     // vals[dst] = vals[dst] - vals[dst+1]
+	opMul                     // vals[dst] = vals[dst] * vals[dst+1]
+	opQuo                     // vals[dst] = vals[dst] / vals[dst+1]
+	opCmp                     // vals[dst] = tests[a](vals[dst] cmp vals[dst+1])
+	opNot                     // vals[dst] = !vals[dst]
+	opTruth                   // vals[dst] = vals[dst] != 0
+	opGeneric                 // vals[dst] = templates[a] applied to vals[dst:]
+	opJumpFalse               // goto a if vals[dst] == 0
+	opJumpTrue                // goto a if vals[dst] != 0
+	opJump                    // goto a
+)
+
+// instr is an instruction of Program. Operands and results are held in registers indexed from dst.
+type instr struct {
+	op  opcode
+	dst int
+	a   int
+	// bounds of the right operand for error messages
+	pos, end int
+	// bounds of the expression whose value the instruction stores, for LimitExceededError
+	xpos, xend int
+}
+
+var cmpTests = map[string]int{"==": 0, "!=": 1, "<": 2, "<=": 3, ">": 4, ">=": 5}
+
+func cmpTest(test int, c int) bool {
+	switch test {
+	case 0:
+		return c == 0
+	case 1:
+		return c != 0
+	case 2:
+		return c < 0
+	case 3:
+		return c <= 0
+	case 4:
+		return c > 0
+	}
+	return c >= 0
+}
+
+var (
+	ratZero = new(big.Rat)
+	ratOne  = big.NewRat(1, 1)
+)
+
+func ratTruth(b bool) *big.Rat {
+	if b {
+		return ratOne
+	}
+	return ratZero
+}
+
+// template describes an operator or a function evaluated by the node of the tree walker,
+// which are instantiated for each vm with literals in place of the operands
+type template struct {
+	x        Expr
+	operands [][2]int
+}
+
+func (t *template) instantiate() (node, []*literal) {
+	lits := make([]*literal, len(t.operands))
+	args := make([]node, len(t.operands))
+	for i, b := range t.operands {
+		lits[i] = &literal{pos: b[0], end: b[1]}
+		args[i] = lits[i]
+	}
+
+	switch x := t.x.(type) {
+	case *UnaryExpr:
+		op := prefixOps[x.Op]()
+		op.setPos(x.OpPos)
+		op.setRight(args[0])
+		return op, lits
+	case *BinaryExpr:
+		op := binaryOps[x.Op].new()
+		op.setPos(x.OpPos)
+		op.setLeft(args[0])
+		op.setRight(args[1])
+		return op, lits
+	}
+	c := t.x.(*Call)
+	return &call{c.Fun.Name, c.Fun.NamePos, args, c.Rparen}, lits
+}
+
+// Program is an expression compiled into instructions for a register machine.
+// Program evaluates the expression like the tree walker of Expression but reuses registers between evaluations,
+// so that evaluating a formula over many rows allocates only for the result in most cases.
+// Registers are a slice rather than stack.Stack since the depth of the stack is known on compile and
+// pushing to stack.Stack allocates.
+// Program is safe for concurrent use.
+type Program struct {
+	expr      *Expression
+	code      []instr
+	consts    []*big.Rat
+	names     []string
+	templates []*template
+	regs      int
+	pool      sync.Pool
+}
+
+// vm holds the registers of an evaluation of Program
+type vm struct {
+	vals    []*big.Rat
+	owned   []*big.Rat
+	ints    []*big.Int
+	loaded  []*big.Rat
+	idents  []*ident
+	nodes   []node
+	lits    [][]*literal
+	s       scope
+	program *Program
+}
+
+// Program compiles the expression into a Program
+func (e *Expression) Program() (*Program, error) {
+	p := &Program{expr: e}
+	if err := p.compile(e.ast, 0); err != nil {
+		return nil, err
+	}
+	p.pool.New = func() interface{} {
+		return p.newVM()
+	}
+	return p, nil
+}
+
+func (p *Program) emit(op opcode, dst, a int) int {
+	p.code = append(p.code, instr{op: op, dst: dst, a: a})
+	if dst+1 > p.regs {
+		p.regs = dst + 1
+	}
+	return len(p.code) - 1
+}
+
+func (p *Program) generic(x Expr, dst int, operands ...Expr) {
+	t := &template{x: x}
+	for _, o := range operands {
+		t.operands = append(t.operands, [2]int{o.Pos(), o.End()})
+	}
+	p.templates = append(p.templates, t)
+	p.emit(opGeneric, dst, len(p.templates)-1)
+}
+
+// compile emits the instructions which store the value of x to the register dst
+func (p *Program) compile(x Expr, dst int) error {
+	start := len(p.code)
+	if err := p.compileExpr(x, dst); err != nil {
+		return err
+	}
+	// the last instruction stores the value of x unless it stores the value of an inner expression like (x)
+	if last := &p.code[len(p.code)-1]; len(p.code) > start && last.xend == 0 {
+		last.xpos, last.xend = x.Pos(), x.End()
+	}
+	return nil
+}
+
+func (p *Program) compileExpr(x Expr, dst int) error {
+	switch x := x.(type) {
+	case *NumberLit:
+		l, ok := newLiteral(x.Value, x.ValuePos)
+		if !ok {
+			return &InvalidLiteralError{Formula: p.expr.formula, Offset: x.ValuePos, Literal: x.Value}
+		}
+		p.consts = append(p.consts, l.v)
+		p.emit(opConst, dst, len(p.consts)-1)
+	case *Ident:
+		i := len(p.names)
+		for j, name := range p.names {
+			if name == x.Name {
+				i = j
+			}
+		}
+		if i == len(p.names) {
+			p.names = append(p.names, x.Name)
+		}
+		p.emit(opLoad, dst, i)
+		p.code[len(p.code)-1].pos = x.NamePos
+	case *Paren:
+		return p.compile(x.X, dst)
+	case *UnaryExpr:
+		if err := p.compile(x.X, dst); err != nil {
+			return err
+		}
+		switch x.Op {
+		case "+":
+		case "-":
+			p.emit(opNeg, dst, 0)
+		case "!":
+			p.emit(opNot, dst, 0)
+		default:
+			p.generic(x, dst, x.X)
+		}
+	case *BinaryExpr:
+		return p.compileBinary(x, dst)
+	case *Call:
+		if x.Fun.Name == "if" {
+			if len(x.Args) != 3 {
+				return &ArityError{Name: x.Fun.Name, Arity: 3, Args: len(x.Args)}
+			}
+			return p.compileCond(x.Args[0], x.Args[1], x.Args[2], dst)
+		}
+		for i, arg := range x.Args {
+			if err := p.compile(arg, dst+i); err != nil {
+				return err
+			}
+		}
+		p.generic(x, dst, x.Args...)
+	case *CondExpr:
+		return p.compileCond(x.Cond, x.Then, x.Else, dst)
+	default:
+		_, err := build(p.expr.formula, x, false)
+		return err
+	}
+	return nil
+}
+
+func (p *Program) compileBinary(x *BinaryExpr, dst int) error {
+	if err := p.compile(x.X, dst); err != nil {
+		return err
+	}
+
+	// short circuit
+	if x.Op == "&&" || x.Op == "||" {
+		op := opJumpFalse
+		if x.Op == "||" {
+			op = opJumpTrue
+		}
+		jump := p.emit(op, dst, 0)
+		if err := p.compile(x.Y, dst); err != nil {
+			return err
+		}
+		p.code[jump].a = p.emit(opTruth, dst, 0)
+		return nil
+	}
+
+	if err := p.compile(x.Y, dst+1); err != nil {
+		return err
+	}
+	switch x.Op {
+	case "+":
+		p.emit(opAdd, dst, 0)
+	case "-":
+		p.emit(opSub, dst, 0)
+	case "*":
+		p.emit(opMul, dst, 0)
+	case "/":
+		p.emit(opQuo, dst, 0)
+		p.code[len(p.code)-1].pos, p.code[len(p.code)-1].end = x.Y.Pos(), x.Y.End()
+	default:
+		if test, ok := cmpTests[x.Op]; ok {
+			p.emit(opCmp, dst, test)
+			return nil
+		}
+		if _, ok := binaryOps[x.Op]; !ok {
+			return fmt.Errorf("unknown binary operator %q", x.Op)
+		}
+		p.generic(x, dst, x.X, x.Y)
+	}
+	return nil
+}
+
+func (p *Program) compileCond(cond, then, els Expr, dst int) error {
+	if err := p.compile(cond, dst); err != nil {
+		return err
+	}
+	toElse := p.emit(opJumpFalse, dst, 0)
+	if err := p.compile(then, dst); err != nil {
+		return err
+	}
+	toEnd := p.emit(opJump, dst, 0)
+	p.code[toElse].a = len(p.code)
+	if err := p.compile(els, dst); err != nil {
+		return err
+	}
+	p.code[toEnd].a = len(p.code)
+	return nil
+}
+
+func (p *Program) newVM() *vm {
+	m := &vm{
+		vals:    make([]*big.Rat, p.regs),
+		owned:   make([]*big.Rat, p.regs),
+		ints:    make([]*big.Int, p.regs),
+		loaded:  make([]*big.Rat, len(p.names)),
+		idents:  make([]*ident, len(p.names)),
+		nodes:   make([]node, len(p.templates)),
+		lits:    make([][]*literal, len(p.templates)),
+		program: p,
+	}
+	for i := range m.owned {
+		m.owned[i] = new(big.Rat)
+		m.ints[i] = new(big.Int)
+	}
+	for i, name := range p.names {
+		m.idents[i] = &ident{name: name}
+	}
+	for i, t := range p.templates {
+		m.nodes[i], m.lits[i] = t.instantiate()
+	}
+	m.s = scope{
+		formula:      p.expr.formula,
+		ctx:          context.Background(),
+		values:       map[string]*big.Rat{},
+		divZero:      p.expr.divZero,
+		approxPow:    p.expr.approxPow,
+		maxPowerBits: p.expr.maxPowerBits,
+		limits:       p.expr.limits,
+	}
+	return m
+}
+
+// Eval returns the calculated rational value of the program with given variables
+func (p *Program) Eval(variables Variables, handler Handler) (*big.Rat, error) {
+	return p.EvalFunctions(variables, nil, handler)
+}
+
+// EvalFunctions returns the calculated rational value of the program with given variables and functions.
+// The result and the errors are the same as the ones of the expression.
+// MaxSteps of the limits of the expression counts executed instructions instead of evaluated nodes.
+func (p *Program) EvalFunctions(variables Variables, functions Functions, handler Handler) (*big.Rat, error) {
+	m := p.pool.Get().(*vm)
+	defer p.pool.Put(m)
+
+	m.s.functions = functions
+	m.s.steps = 0
+	m.s.resolver = nil
+	for i := range m.loaded {
+		m.loaded[i] = nil
+	}
+	clear(m.s.values)
+
+	v, err := m.run(variables, handler)
+	m.s.functions = nil
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Set(v), nil
+}
+
+func (m *vm) run(variables Variables, handler Handler) (*big.Rat, error) {
+	p := m.program
+	vals, owned := m.vals, m.owned
+	limited := p.expr.limits.evaluated()
+
+	for pc := 0; pc < len(p.code); pc++ {
+		in := &p.code[pc]
+		d := in.dst
+		switch in.op {
+		case opConst:
+			vals[d] = p.consts[in.a]
+		case opLoad:
+			v := m.loaded[in.a]
+			if v == nil {
+				var err error
+				if v, err = m.load(in.a, variables, handler); err != nil {
+					return nil, err
+				}
+			}
+			vals[d] = v
+		case opNeg:
+			vals[d] = owned[d].Neg(vals[d])
+		case opAdd, opSub, opMul:
+			vals[d] = m.arith(in.op, d)
+		case opQuo:
+			if vals[d+1].Sign() == 0 {
+				if m.s.divZero == nil {
+					return nil, &DivisionByZeroError{Expr: p.expr.formula[in.pos:in.end]}
+				}
+				vals[d] = m.s.divZero
+			} else {
+				vals[d] = owned[d].Quo(vals[d], vals[d+1])
+			}
+		case opCmp:
+			x, y := vals[d], vals[d+1]
+			if x.IsInt() && y.IsInt() {
+				// Rat.Cmp allocates for cross multiplication
+				vals[d] = ratTruth(cmpTest(in.a, x.Num().Cmp(y.Num())))
+			} else {
+				vals[d] = ratTruth(cmpTest(in.a, x.Cmp(y)))
+			}
+		case opNot:
+			vals[d] = ratTruth(vals[d].Sign() == 0)
+		case opTruth:
+			vals[d] = ratTruth(vals[d].Sign() != 0)
+		case opGeneric:
+			for i, l := range m.lits[in.a] {
+				l.v = vals[d+i]
+			}
+			v, err := m.nodes[in.a].val(&m.s)
+			if err != nil {
+				return nil, err
+			}
+			// copy since the result may be an operand held in another register
+			vals[d] = owned[d].Set(v)
+		case opJumpFalse:
+			if vals[d].Sign() == 0 {
+				pc = in.a - 1
+			}
+			continue
+		case opJumpTrue:
+			if vals[d].Sign() != 0 {
+				pc = in.a - 1
+			}
+			continue
+		case opJump:
+			pc = in.a - 1
+			continue
+		}
+
+		if limited {
+			if err := m.check(vals[d], in); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vals[0], nil
+}
+
+// arith computes +, - or * of the registers from d into the register d.
+// Integers are computed by big.Int in the scratch of the register since big.Rat allocates temporaries.
+func (m *vm) arith(op opcode, d int) *big.Rat {
+	x, y, z := m.vals[d], m.vals[d+1], m.owned[d]
+	if x.IsInt() && y.IsInt() {
+		i := m.ints[d]
+		switch op {
+		case opAdd:
+			i.Add(x.Num(), y.Num())
+		case opSub:
+			i.Sub(x.Num(), y.Num())
+		default:
+			i.Mul(x.Num(), y.Num())
+		}
+		return z.SetInt(i)
+	}
+	switch op {
+	case opAdd:
+		return z.Add(x, y)
+	case opSub:
+		return z.Sub(x, y)
+	}
+	return z.Mul(x, y)
+}
+
+// load resolves the identifier of given index like the tree walker
+func (m *vm) load(i int, variables Variables, handler Handler) (*big.Rat, error) {
+	v, ok := variables[m.program.names[i]]
+	// nil values are rejected by the resolver like the tree walker
+	if !ok || v == nil {
+		if m.s.resolver == nil {
+			m.s.resolver = Chain(variables, handler)
+		}
+		id := m.idents[i]
+		var err error
+		if v, err = id.val(&m.s); err != nil {
+			return nil, err
+		}
+	}
+	m.loaded[i] = v
+	return v, nil
+}
+
+// check enforces MaxSteps and MaxBits of the limits of the expression
+func (m *vm) check(v *big.Rat, in *instr) error {
+	m.s.steps++
+	if max := m.s.limits.MaxSteps; max > 0 && m.s.steps > max {
+		return &LimitExceededError{Limit: "MaxSteps", Max: max}
+	}
+	if max := m.s.limits.MaxBits; max > 0 && (v.Num().BitLen() > max || v.Denom().BitLen() > max) {
+		return &LimitExceededError{Limit: "MaxBits", Max: max, Expr: m.program.expr.formula[in.xpos:in.xend]}
+	}
+	return nil
+}
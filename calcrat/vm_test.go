@@ -0,0 +1,173 @@
+package calcrat_test
+
+import (
+	"math/big"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/tamaxyo/go-utils/calcrat"
+	. "github.com/tamaxyo/go-utils/testing"
+)
+
+func TestProgramMatchesTreeWalker(t *testing.T) {
+	g := &formulaGen{
+		r:      rand.New(rand.NewSource(2)),
+		leaves: []string{"a", "b", "c", "h", "x", "0", "1", "2", "3", "4", "15%"},
+		prefix: []string{"-", "+", "^", "~", "!"},
+		binary: []string{"+", "-", "*", "/", "%", "//", "**", "<<", ">>", "&", "|", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||"},
+		funcs:  []genFunc{{"max", 2}, {"if", 3}},
+		cond:   true,
+		tight:  true,
+	}
+	vars := calcrat.Variables{
+		"a": big.NewRat(3, 1),
+		"b": big.NewRat(-2, 1),
+		"c": big.NewRat(1, 2),
+	}
+	handler := func(name string) *big.Rat {
+		if name == "h" {
+			return big.NewRat(7, 3)
+		}
+		return nil
+	}
+
+	for i := 0; i < 5000; i++ {
+		formula := g.gen(5)
+		e, err := calcrat.Compile(formula)
+		if err != nil {
+			continue
+		}
+		if i%2 == 0 {
+			e = e.WithDivisionByZero(big.NewRat(0, 1))
+		}
+		p, err := e.Program()
+		OK(t, err)
+
+		expected, expectedErr := e.Eval(vars, handler)
+		for j := 0; j < 2; j++ {
+			actual, err := p.Eval(vars, handler)
+			if expectedErr != nil {
+				ASSERT(t, "program should fail: "+formula, err != nil)
+				EQUALS(t, "program should return the same error: "+formula, expectedErr.Error(), err.Error())
+				continue
+			}
+			OK(t, err)
+			EQUALS(t, "program should return the same value: "+formula, expected.RatString(), actual.RatString())
+		}
+	}
+}
+
+func TestProgramCanBeEvaluatedConcurrently(t *testing.T) {
+	e, err := calcrat.Compile("x * x - max(x, 1) / 2")
+	OK(t, err)
+	p, err := e.Program()
+	OK(t, err)
+
+	results := make([]*big.Rat, 100)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = p.Eval(calcrat.Variables{"x": big.NewRat(int64(i), 1)}, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, actual := range results {
+		x := big.NewRat(int64(i), 1)
+		expected, err := e.Eval(calcrat.Variables{"x": x}, nil)
+		OK(t, err)
+		EQUALS(t, "concurrent evaluation should not interfere", expected.RatString(), actual.RatString())
+	}
+}
+
+const benchIntFormula = "(quantity*tax - discount)*100 + quantity"
+
+func TestProgramAllocatesOnlyForResult(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with the race detector")
+	}
+	vars := benchVariables()
+	tests := []struct {
+		formula string
+		allocs  float64
+	}{
+		// non-integer operations allocate temporaries of big.Rat
+		{benchFormula, 19},
+		// the result and its numerator and denominator
+		{benchIntFormula, 3},
+	}
+	for _, test := range tests {
+		e, err := calcrat.Compile(test.formula)
+		OK(t, err)
+		p, err := e.Program()
+		OK(t, err)
+
+		allocs := testing.AllocsPerRun(100, func() { p.Eval(vars, nil) })
+		ASSERT(t, "program should not allocate more than expected: "+test.formula, allocs <= test.allocs)
+	}
+}
+
+func TestProgramReturnsSameErrorsAsExpression(t *testing.T) {
+	tests := []struct {
+		formula string
+		limits  calcrat.Limits
+		vars    calcrat.Variables
+	}{
+		{"x + 1", calcrat.Limits{}, calcrat.Variables{"x": nil}},
+		{"(x * x) * x + 1", calcrat.Limits{MaxBits: 64}, calcrat.Variables{"x": big.NewRat(1<<30, 1)}},
+		{"1 + (x * x)", calcrat.Limits{MaxBits: 32}, calcrat.Variables{"x": big.NewRat(1<<20, 1)}},
+	}
+	for _, test := range tests {
+		e, err := calcrat.CompileLimits(test.formula, test.limits)
+		OK(t, err)
+		p, err := e.Program()
+		OK(t, err)
+
+		_, expected := e.Eval(test.vars, nil)
+		_, actual := p.Eval(test.vars, nil)
+		ASSERT(t, "expression should fail: "+test.formula, expected != nil)
+		ASSERT(t, "program should fail: "+test.formula, actual != nil)
+		EQUALS(t, "program should return the same error: "+test.formula, expected.Error(), actual.Error())
+	}
+}
+
+func benchmarkProgram(b *testing.B, formula string) {
+	vars := benchVariables()
+	e, err := calcrat.Compile(formula)
+	if err != nil {
+		b.Fatal(err)
+	}
+	p, err := e.Program()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Eval(vars, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkTree(b *testing.B, formula string) {
+	vars := benchVariables()
+	e, err := calcrat.Compile(formula)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(vars, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B)         { benchmarkProgram(b, benchFormula) }
+func BenchmarkProgramEvalIntegers(b *testing.B) { benchmarkProgram(b, benchIntFormula) }
+func BenchmarkTreeEvalIntegers(b *testing.B)    { benchmarkTree(b, benchIntFormula) }